@@ -0,0 +1,347 @@
+package reflectx
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// defaultMaxMemory is the default max memory to parse multipart forms, the
+// same as http.Request.FormValue.
+const defaultMaxMemory = 32 << 20
+
+var (
+	fileHeaderType = reflect.TypeOf(multipart.FileHeader{})
+	bytesType      = reflect.TypeOf([]byte(nil))
+	errFileField   = errors.New("reflectx: can not bind string to file field")
+)
+
+// WithMaxMemory sets the max memory to parse multipart forms by Bind, the
+// rest of files are stored on disk. It limits the size of a file bound to
+// []byte as well, default is 32MB.
+func WithMaxMemory(n int64) FormOption {
+	return func(fm *FormMapper) {
+		fm.maxMemory = n
+	}
+}
+
+// registerFileConverter makes multipart.FileHeader a leaf of the mapping, so
+// that the fields of it are not bound to strings.
+func registerFileConverter(cs *converters) {
+	cs.register(fileHeaderType,
+		func(v reflect.Value) (string, error) {
+			return v.Interface().(multipart.FileHeader).Filename, nil
+		},
+		func(s string, v reflect.Value) error {
+			return errFileField
+		})
+}
+
+// Bind parses the query, urlencoded and multipart body of r, and binds them
+// to the struct that ptr points to by FormToStruct.
+// The file parts are bound to the fields with the types below:
+//	*multipart.FileHeader, []*multipart.FileHeader, []byte, [][]byte
+// For example:
+//	type Upload struct {
+//		Name   string                  `form:"name"`
+//		Avatar *multipart.FileHeader   `form:"avatar"`
+//		Docs   []*multipart.FileHeader `form:"docs"`
+//		Data   []byte                  `form:"data"`
+//	}
+// The temporary files of r.MultipartForm should be removed by RemoveAll after handling.
+func (fm FormMapper) Bind(r *http.Request, ptr interface{}) error {
+	if err := r.ParseMultipartForm(fm.maxMemory); err != nil && err != http.ErrNotMultipart {
+		return err
+	}
+	// r.Form contains the query, urlencoded and multipart values.
+	val := reflect.ValueOf(ptr).Elem()
+	errs := fm.formToStruct(r.Form, val)
+	if r.MultipartForm == nil {
+		return fm.validate(val, errs.err())
+	}
+
+	for k, files := range r.MultipartForm.File {
+		if len(files) == 0 {
+			continue
+		}
+		segs := splitKey(k)
+		if !fm.permitted(val.Type(), segs) {
+			continue
+		}
+		if err := fm.bindPath(val, segs, fileValues(files)); err != nil {
+			names := make([]string, len(files))
+			for i, fh := range files {
+				names[i] = fh.Filename
+			}
+			errs = append(errs, newBindError(k, segs, names, err))
+		}
+	}
+	return fm.validate(val, errs.err())
+}
+
+type fileValues []*multipart.FileHeader
+
+func (fs fileValues) len() int {
+	return len(fs)
+}
+
+func (fs fileValues) slice(i, j int) formValues {
+	return fs[i:j]
+}
+
+func (fs fileValues) setTo(v reflect.Value, fm FormMapper) error {
+	switch v.Type() {
+	case reflect.PtrTo(fileHeaderType):
+		if len(fs) > 1 {
+			return fmt.Errorf("expected one file, got %d", len(fs))
+		}
+		v.Set(reflect.ValueOf(fs[0]))
+		return nil
+	case reflect.SliceOf(reflect.PtrTo(fileHeaderType)):
+		v.Set(reflect.ValueOf([]*multipart.FileHeader(fs)))
+		return nil
+	case bytesType:
+		if len(fs) > 1 {
+			return fmt.Errorf("expected one file, got %d", len(fs))
+		}
+		b, err := readFile(fs[0], fm.maxMemory)
+		if err != nil {
+			return err
+		}
+		v.SetBytes(b)
+		return nil
+	case reflect.SliceOf(bytesType):
+		s := make([][]byte, len(fs))
+		for i := range fs {
+			b, err := readFile(fs[i], fm.maxMemory)
+			if err != nil {
+				return err
+			}
+			s[i] = b
+		}
+		v.Set(reflect.ValueOf(s))
+		return nil
+	case reflect.PtrTo(bytesType):
+		return fs.setTo(AllocIndirect(v), fm)
+	default:
+		return fmt.Errorf("unexpected type for files: %v", v.Type())
+	}
+}
+
+// readFile reads the content of the file, the size of it must not be greater than max.
+func readFile(fh *multipart.FileHeader, max int64) ([]byte, error) {
+	if fh.Size > max {
+		return nil, fmt.Errorf("size of file %q exceeds %d bytes", fh.Filename, max)
+	}
+	f, err := fh.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(io.LimitReader(f, max))
+}
+
+// Binder binds requests to structs by the Content-Type of them, the fields
+// are mapped by the same tag name whatever the Content-Type is.
+//	GET, HEAD or no body                binds the query by FormMapper
+//	application/x-www-form-urlencoded   binds the query and body by FormMapper
+//	multipart/form-data                 binds the query, body and files by FormMapper
+//	application/json, */*+json          binds the query by FormMapper and the body by Reflector
+//	application/xml, text/xml, */*+xml  binds the query by FormMapper and the body by Reflector
+// The unknown keys of json and xml are ignored, the same as forms. The keys
+// not permitted by the policies of fields such as "readonly" and DenyFields
+// are ignored as well, whatever the Content-Type is.
+type Binder struct {
+	form      FormMapper
+	reflector reflector
+}
+
+// NewBinder returns a Binder with the tagName and tagFunc, default tagName is "form".
+func NewBinder(tagName string, tagFunc TagFunc, opts ...FormOption) Binder {
+	if tagName == "" {
+		tagName = "form"
+	}
+	return Binder{
+		form:      NewFormMapper(tagName, tagFunc, opts...),
+		reflector: NewReflector("json", tagName, tagFunc, WithUnknownFields(IgnoreUnknownFields)).(reflector),
+	}
+}
+
+// RegisterConverter registers the converter of type t to both the FormMapper and the Reflector.
+func (b Binder) RegisterConverter(t reflect.Type, encode EncodeFunc, decode DecodeFunc) {
+	b.form.RegisterConverter(t, encode, decode)
+	b.reflector.RegisterConverter(t, encode, decode)
+}
+
+// Bind binds r to the struct that ptr points to by the Content-Type of r.
+// The size of json or xml body is limited by WithMaxMemory. The struct is
+// validated after binding the query and body if ValidateForms is set.
+func (b Binder) Bind(r *http.Request, ptr interface{}) error {
+	if r.Method == http.MethodGet || r.Method == http.MethodHead || r.Body == nil || r.Body == http.NoBody {
+		return b.form.FormToStruct(r.URL.Query(), ptr)
+	}
+
+	ct := r.Header.Get("Content-Type")
+	if ct != "" {
+		var err error
+		if ct, _, err = mime.ParseMediaType(ct); err != nil {
+			return err
+		}
+	}
+	switch {
+	case ct == "", ct == "application/x-www-form-urlencoded", ct == "multipart/form-data":
+		return b.form.Bind(r, ptr)
+	case ct == "application/json", strings.HasSuffix(ct, "+json"):
+		return b.bindTree(r, ptr, false, func(rd io.Reader) (interface{}, error) {
+			var tree interface{}
+			d := json.NewDecoder(rd)
+			d.UseNumber()
+			if err := d.Decode(&tree); err != nil {
+				if err == io.EOF {
+					// an empty body.
+					return nil, nil
+				}
+				return nil, err
+			}
+			if _, err := d.Token(); err != io.EOF {
+				if err == nil {
+					err = errors.New("reflectx: unexpected data after the json value")
+				}
+				return nil, err
+			}
+			return tree, nil
+		})
+	case ct == "application/xml", ct == "text/xml", strings.HasSuffix(ct, "+xml"):
+		return b.bindTree(r, ptr, true, decodeXML)
+	default:
+		return errors.New("reflectx: unsupported content type: " + ct)
+	}
+}
+
+// With returns a copy of the Binder with opts, see FormMapper.With.
+func (b Binder) With(opts ...FormOption) Binder {
+	b.form = b.form.With(opts...)
+	return b
+}
+
+// body returns the body of r limited by maxMemory.
+func (b Binder) body(r *http.Request) io.Reader {
+	return http.MaxBytesReader(nil, r.Body, b.form.maxMemory)
+}
+
+// bindTree binds the query of r by FormMapper, and then the body decoded by
+// decode to a tree of values like json.Unmarshal. The keys not permitted by
+// the FormMapper are pruned, the strings are normalized and the time options
+// are applied before decoding the tree by Reflector, and the struct is
+// validated at last. With singleToSlice, a single value is decoded
+// to a slice field as well.
+func (b Binder) bindTree(r *http.Request, ptr interface{}, singleToSlice bool, decode func(rd io.Reader) (interface{}, error)) error {
+	v := reflect.ValueOf(ptr)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return fmt.Errorf("reflectx: Bind expects a non-nil pointer, got %T", ptr)
+	}
+	val := v.Elem()
+	if err := b.form.formToStruct(r.URL.Query(), val).err(); err != nil {
+		return err
+	}
+	tree, err := decode(b.body(r))
+	if err != nil || tree == nil {
+		return b.form.validate(val, err)
+	}
+	var errs BindErrors
+	tree = b.form.prune(val.Type(), nil, tree, &errs)
+	if err := errs.err(); err != nil {
+		return err
+	}
+
+	rf := b.reflector
+	rf.singleToSlice = singleToSlice
+	d, err := newDecodeState(rf, tree)
+	if err == nil {
+		err = d.result(d.decodeInto(tree, val))
+	}
+	return b.form.validate(val, err)
+}
+
+// xmlNode is an element decoding by decodeXML.
+type xmlNode struct {
+	fields map[string]interface{}
+	text   strings.Builder
+}
+
+func (n *xmlNode) add(name string, v interface{}) {
+	if v == "" {
+		// empty values are ignored, the same as forms.
+		return
+	}
+	if n.fields == nil {
+		n.fields = make(map[string]interface{})
+	}
+	switch old := n.fields[name].(type) {
+	case nil:
+		n.fields[name] = v
+	case []interface{}:
+		n.fields[name] = append(old, v)
+	default:
+		n.fields[name] = []interface{}{old, v}
+	}
+}
+
+func (n *xmlNode) value() interface{} {
+	if n.fields == nil {
+		return strings.TrimSpace(n.text.String())
+	}
+	return n.fields
+}
+
+// decodeXML decodes the xml document to the values like json.Unmarshal, the
+// name of root element is ignored. The attributes and child elements are keys
+// of map, repeated elements are []interface{}, and elements without attributes
+// or children are strings. Empty attributes and elements are omitted. It
+// returns nil for an empty document.
+func decodeXML(rd io.Reader) (interface{}, error) {
+	d := xml.NewDecoder(rd)
+	var stack []*xmlNode
+	var names []string
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &xmlNode{}
+			for _, attr := range t.Attr {
+				n.add(attr.Name.Local, attr.Value)
+			}
+			stack = append(stack, n)
+			names = append(names, t.Name.Local)
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text.Write(t)
+			}
+		case xml.EndElement:
+			n, name := stack[len(stack)-1], names[len(names)-1]
+			stack, names = stack[:len(stack)-1], names[:len(names)-1]
+			if len(stack) == 0 {
+				if _, ok := n.value().(string); ok {
+					// the root element without children.
+					return map[string]interface{}{}, nil
+				}
+				return n.value(), nil
+			}
+			stack[len(stack)-1].add(name, n.value())
+		}
+	}
+}
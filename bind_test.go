@@ -0,0 +1,160 @@
+package reflectx
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type Upload struct {
+	Name   string                  `form:"name"`
+	Page   int                     `form:"page"`
+	Avatar *multipart.FileHeader   `form:"avatar"`
+	Docs   []*multipart.FileHeader `form:"docs"`
+	Data   []byte                  `form:"data"`
+	Items  []struct {
+		Title string                `form:"title"`
+		File  *multipart.FileHeader `form:"file"`
+	} `form:"items"`
+}
+
+func newMultipartRequest(t *testing.T, target string, fields map[string]string, files map[string][]string) *http.Request {
+	body := &bytes.Buffer{}
+	w := multipart.NewWriter(body)
+	for k, v := range fields {
+		assert.Nil(t, w.WriteField(k, v))
+	}
+	for k, contents := range files {
+		for i, content := range contents {
+			part, err := w.CreateFormFile(k, k+string(rune('0'+i))+".txt")
+			assert.Nil(t, err)
+			part.Write([]byte(content))
+		}
+	}
+	assert.Nil(t, w.Close())
+
+	r := httptest.NewRequest(http.MethodPost, target, body)
+	r.Header.Set("Content-Type", w.FormDataContentType())
+	return r
+}
+
+func TestBind(t *testing.T) {
+	r := newMultipartRequest(t, "/upload?page=2",
+		map[string]string{"name": "bob", "items[0][title]": "first"},
+		map[string][]string{
+			"avatar":         {"avatar"},
+			"docs":           {"doc1", "doc2"},
+			"data":           {"some data"},
+			"items[0][file]": {"item file"},
+		})
+
+	var u Upload
+	assert.Nil(t, Bind(r, &u))
+	assert.Equal(t, "bob", u.Name)
+	assert.Equal(t, 2, u.Page)
+	assert.Equal(t, "avatar0.txt", u.Avatar.Filename)
+	assert.Len(t, u.Docs, 2)
+	assert.Equal(t, "docs1.txt", u.Docs[1].Filename)
+	assert.Equal(t, []byte("some data"), u.Data)
+	assert.Len(t, u.Items, 1)
+	assert.Equal(t, "first", u.Items[0].Title)
+	assert.Equal(t, "items[0][file]0.txt", u.Items[0].File.Filename)
+
+	// urlencoded body and query.
+	r = httptest.NewRequest(http.MethodPost, "/upload?page=3", strings.NewReader("name=alice"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	u = Upload{}
+	assert.Nil(t, Bind(r, &u))
+	assert.Equal(t, "alice", u.Name)
+	assert.Equal(t, 3, u.Page)
+
+	// text value can not be bound to a file field.
+	r = httptest.NewRequest(http.MethodGet, "/upload?avatar=x", nil)
+	assert.EqualError(t, Bind(r, &u), "reflectx: can not bind avatar to multipart.FileHeader: can not bind string to file field")
+
+	// the size of file bound to []byte is limited.
+	r = newMultipartRequest(t, "/upload", nil, map[string][]string{"data": {"0123456789"}})
+	err := NewFormMapper("", nil, WithMaxMemory(8)).Bind(r, &u)
+	assert.EqualError(t, err, `reflectx: can not bind data to []uint8: size of file "data0.txt" exceeds 8 bytes`)
+
+	r = newMultipartRequest(t, "/upload", nil, map[string][]string{"avatar": {"a", "b"}})
+	err = Bind(r, &u)
+	assert.EqualError(t, err, "reflectx: can not bind avatar to *multipart.FileHeader: expected one file, got 2")
+}
+
+type Signup struct {
+	Name  string   `form:"name"`
+	Age   int      `form:"age"`
+	Tags  []string `form:"tags"`
+	Page  int      `form:"page"`
+	Addr  *Address `form:"addr"`
+	Token string   `form:"-"`
+}
+
+type Address struct {
+	City string `form:"city"`
+}
+
+func TestBinder(t *testing.T) {
+	b := NewBinder("", nil)
+	expect := Signup{Name: "bob", Age: 18, Tags: []string{"a"}, Page: 2, Addr: &Address{"x"}}
+
+	for ct, body := range map[string]string{
+		"application/x-www-form-urlencoded": "name=bob&age=18&tags=a&addr.city=x",
+		"application/json; charset=utf-8":   `{"name": "bob", "age": 18, "tags": ["a"], "addr": {"city": "x"}, "unknown": 1}`,
+		"application/vnd.api+json":          `{"name": "bob", "age": 18, "tags": ["a"], "addr": {"city": "x"}}`,
+		"application/xml":                   `<signup name="bob"><age>18</age><tags>a</tags><addr><city>x</city></addr><Token>t</Token></signup>`,
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/signup?page=2", strings.NewReader(body))
+		r.Header.Set("Content-Type", ct)
+		var s Signup
+		assert.Nil(t, b.Bind(r, &s), ct)
+		assert.Equal(t, expect, s, ct)
+	}
+
+	r := newMultipartRequest(t, "/signup?page=2", map[string]string{"name": "bob", "age": "18", "tags": "a", "addr[city]": "x"}, nil)
+	var s Signup
+	assert.Nil(t, b.Bind(r, &s))
+	assert.Equal(t, expect, s)
+
+	r = httptest.NewRequest(http.MethodGet, "/signup?name=bob&age=18&tags=a&page=2&addr.city=x", nil)
+	s = Signup{}
+	assert.Nil(t, b.Bind(r, &s))
+	assert.Equal(t, expect, s)
+
+	r = httptest.NewRequest(http.MethodPost, "/signup", strings.NewReader(`<signup><tags>a</tags><tags>b</tags></signup>`))
+	r.Header.Set("Content-Type", "text/xml")
+	s = Signup{}
+	assert.Nil(t, b.Bind(r, &s))
+	assert.Equal(t, []string{"a", "b"}, s.Tags)
+
+	// empty elements and attributes are ignored, the same as empty form values.
+	r = httptest.NewRequest(http.MethodPost, "/signup", strings.NewReader(`<signup name=""><age/><addr><city></city></addr><tags> </tags></signup>`))
+	r.Header.Set("Content-Type", "text/xml")
+	s = Signup{Name: "bob", Age: 18}
+	assert.Nil(t, b.Bind(r, &s))
+	assert.Equal(t, Signup{Name: "bob", Age: 18}, s)
+
+	// only one json value is allowed in the body.
+	for _, body := range []string{`{"age": 3} {"age": "zz"}`, `{"age": 3} x`, `{"age": 3}[]`} {
+		r = httptest.NewRequest(http.MethodPost, "/signup", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		assert.NotNil(t, b.Bind(r, &Signup{}), body)
+	}
+	r = httptest.NewRequest(http.MethodPost, "/signup", strings.NewReader("{\"age\": 3}\n"))
+	r.Header.Set("Content-Type", "application/json")
+	assert.Nil(t, b.Bind(r, &s))
+
+	r = httptest.NewRequest(http.MethodPost, "/signup", strings.NewReader("name: bob"))
+	r.Header.Set("Content-Type", "text/yaml")
+	assert.EqualError(t, b.Bind(r, &s), "reflectx: unsupported content type: text/yaml")
+
+	r = httptest.NewRequest(http.MethodPost, "/signup", strings.NewReader(`{"name": "0123456789"}`))
+	r.Header.Set("Content-Type", "application/json")
+	assert.EqualError(t, NewBinder("", nil, WithMaxMemory(8)).Bind(r, &s), "http: request body too large")
+}
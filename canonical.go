@@ -0,0 +1,205 @@
+package reflectx
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// marshalCanonical returns the json of v in the JSON Canonicalization Scheme
+// defined by RFC 8785: no insignificant whitespace, the keys of objects are
+// sorted by UTF-16 code units, numbers are serialized as ECMAScript does and
+// strings are escaped minimally.
+// Note that numbers are IEEE 754 doubles in JCS, so the integers which can not
+// be represented exactly by a double, such as most of them beyond 2^53, are
+// serialized as strings as recommended by the appendix of RFC 8785.
+func marshalCanonical(v interface{}) ([]byte, error) {
+	// json.Marshal calls the marshalers and replaces invalid UTF-8, the result
+	// is decoded again to be canonicalized.
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var val interface{}
+	if err = unmarshalJSON(b, &val); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err = writeCanonical(&buf, val); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeCanonical writes val decoded by unmarshalJSON to buf.
+func writeCanonical(buf *bytes.Buffer, val interface{}) error {
+	switch vv := val.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bool:
+		buf.WriteString(strconv.FormatBool(vv))
+	case string:
+		writeCanonicalString(buf, vv)
+	case json.Number:
+		f, err := vv.Float64()
+		if err != nil {
+			return err
+		}
+		if isInteger(string(vv)) && strconv.FormatFloat(f, 'f', -1, 64) != string(vv) {
+			// the integer loses precision as a double.
+			writeCanonicalString(buf, string(vv))
+			return nil
+		}
+		s, err := canonicalNumber(f)
+		if err != nil {
+			return err
+		}
+		buf.WriteString(s)
+	case []interface{}:
+		buf.WriteByte('[')
+		for i, elem := range vv {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeCanonical(buf, elem); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case map[string]interface{}:
+		keys := make([]string, 0, len(vv))
+		for k := range vv {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			return lessUTF16(keys[i], keys[j])
+		})
+		buf.WriteByte('{')
+		for i, k := range keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeCanonicalString(buf, k)
+			buf.WriteByte(':')
+			if err := writeCanonical(buf, vv[k]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	default:
+		return fmt.Errorf("reflectx: unexpected type for canonical json: %T", val)
+	}
+	return nil
+}
+
+// writeCanonicalString escapes only '"', '\\' and the control characters,
+// the short forms are used if they exist.
+func writeCanonicalString(buf *bytes.Buffer, s string) {
+	buf.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			buf.WriteString(`\"`)
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\b':
+			buf.WriteString(`\b`)
+		case '\f':
+			buf.WriteString(`\f`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		default:
+			if r < 0x20 {
+				fmt.Fprintf(buf, `\u%04x`, r)
+			} else {
+				buf.WriteRune(r)
+			}
+		}
+	}
+	buf.WriteByte('"')
+}
+
+// canonicalNumber formats f as Number.prototype.toString of ECMAScript.
+func canonicalNumber(f float64) (string, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return "", fmt.Errorf("reflectx: unsupported number for canonical json: %v", f)
+	}
+	if f == 0 {
+		// -0 is serialized as 0.
+		return "0", nil
+	}
+
+	sign := ""
+	if f < 0 {
+		sign = "-"
+		f = -f
+	}
+	format := byte('e')
+	if f < 1e21 && f >= 1e-6 {
+		format = 'f'
+	}
+	s := strconv.FormatFloat(f, format, -1, 64)
+	// Go formats the exponent as "1e+09", ECMAScript as "1e+9".
+	if i := strings.IndexByte(s, 'e'); i > 0 && s[i+2] == '0' {
+		s = s[:i+2] + s[i+3:]
+	}
+	return sign + s, nil
+}
+
+// isInteger returns whether the json number s has neither fraction nor exponent.
+func isInteger(s string) bool {
+	return !strings.ContainsAny(s, ".eE")
+}
+
+// lessUTF16 compares a and b by UTF-16 code units.
+func lessUTF16(a, b string) bool {
+	for a != "" && b != "" {
+		ra, na := utf8.DecodeRuneInString(a)
+		rb, nb := utf8.DecodeRuneInString(b)
+		if ra != rb {
+			return utf16Units(ra) < utf16Units(rb)
+		}
+		a, b = a[na:], b[nb:]
+	}
+	return a == "" && b != ""
+}
+
+// utf16Units returns the code units of r as a comparable number, the first
+// unit is in the high bits.
+func utf16Units(r rune) uint32 {
+	if r1, r2 := utf16.EncodeRune(r); r1 != utf8.RuneError {
+		return uint32(r1)<<16 | uint32(r2)
+	}
+	return uint32(r) << 16
+}
+
+// Hash returns the SHA-256 of v encoded in canonical json, the same value
+// always has the same hash whatever the format of the Reflector is.
+func (r reflector) Hash(v interface{}) ([]byte, error) {
+	b, err := r.canonicalize().Encode(v)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(b)
+	return sum[:], nil
+}
+
+// canonicalize returns a copy of r with the "canonicaljson" format.
+func (r reflector) canonicalize() reflector {
+	r.format = "canonicaljson"
+	r.marshal = marshalCanonical
+	r.unmarshal = unmarshalJSON
+	return r
+}
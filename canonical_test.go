@@ -0,0 +1,131 @@
+package reflectx
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCanonicalNumber(t *testing.T) {
+	Convey("should format numbers as ECMAScript", t, func() {
+		for f, s := range map[float64]string{
+			0:                        "0",
+			math.Copysign(0, -1):     "0",
+			1:                        "1",
+			-1.5:                     "-1.5",
+			5e-324:                   "5e-324",
+			math.MaxFloat64:          "1.7976931348623157e+308",
+			9007199254740992:         "9007199254740992",
+			1e21:                     "1e+21",
+			999999999999999900000:    "999999999999999900000",
+			0.000001:                 "0.000001",
+			0.0000009999999999999997: "9.999999999999997e-7",
+			1e-7:                     "1e-7",
+			1.0000000000000002:       "1.0000000000000002",
+		} {
+			str, err := canonicalNumber(f)
+			So(err, ShouldBeNil)
+			So(str, ShouldEqual, s)
+		}
+
+		_, err := canonicalNumber(math.NaN())
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestCanonical(t *testing.T) {
+	Convey("should sort keys by UTF-16 code units", t, func() {
+		b, err := marshalCanonical(map[string]interface{}{
+			"\u20ac":     "Euro Sign",
+			"\r":         "Carriage Return",
+			"\ufb33":     "Hebrew Letter Dalet With Dagesh",
+			"1":          "One",
+			"\U0001f600": "Emoji: Grinning Face",
+			"\u0080":     "Control",
+			"\u00f6":     "Latin Small Letter O With Diaeresis",
+		})
+		So(err, ShouldBeNil)
+		So(string(b), ShouldEqual, "{\"\\r\":\"Carriage Return\",\"1\":\"One\",\"\u0080\":\"Control\","+
+			"\"\u00f6\":\"Latin Small Letter O With Diaeresis\",\"\u20ac\":\"Euro Sign\","+
+			"\"\U0001f600\":\"Emoji: Grinning Face\",\"\ufb33\":\"Hebrew Letter Dalet With Dagesh\"}")
+	})
+
+	Convey("should escape strings minimally", t, func() {
+		b, err := marshalCanonical([]interface{}{"<a & b>\u2028", "\"\\\b\f\n\r\t\x01", 1.0, 1e30, nil, true})
+		So(err, ShouldBeNil)
+		So(string(b), ShouldEqual, "[\"<a & b>\u2028\",\"\\\"\\\\\\b\\f\\n\\r\\t\\u0001\",1,1e+30,null,true]")
+	})
+
+	Convey("should encode the same value to the same bytes", t, func() {
+		i := 1
+		s := "string"
+		bar := Bar{&i, &s}
+		v := Foo{F: 1, O: map[string]interface{}{"b": bar, "a": []interface{}{1.50, "x"}, "c": map[int]string{10: "x", 2: "y"}}}
+
+		r := NewReflector("canonicaljson", "", nil)
+		r.Register(Foo{})
+		r.Register(Bar{})
+		b, err := r.Encode(v)
+		So(err, ShouldBeNil)
+		So(string(b), ShouldEqual, `{"O":{"a":[1.5,"x"],"b":{"Ar":"string","B":1,"_struct_name":"reflectx.Bar"},"c":{"10":"x","2":"y"}},"_struct_name":"reflectx.Foo","f":1}`)
+
+		var rv Foo
+		So(r.DecodeInto(b, &rv), ShouldBeNil)
+		So(rv.F, ShouldEqual, 1)
+
+		sum, err := r.Hash(v)
+		So(err, ShouldBeNil)
+		So(sum, ShouldHaveLength, 32)
+
+		// the hash does not depend on the format of the Reflector.
+		for _, format := range []string{"json", "indentedjson", "bson"} {
+			other, err := NewReflector(format, "", nil).Hash(v)
+			So(err, ShouldBeNil)
+			So(bytes.Equal(other, sum), ShouldBeTrue)
+		}
+
+		v.F = 2
+		other, err := r.Hash(v)
+		So(err, ShouldBeNil)
+		So(bytes.Equal(other, sum), ShouldBeFalse)
+	})
+	Convey("should keep the integers beyond the precision of doubles", t, func() {
+		type BigInts struct {
+			I int64
+			U uint64
+		}
+		r := NewReflector("canonicaljson", "", nil)
+		r.Register(BigInts{})
+		for _, v := range []BigInts{
+			{I: math.MaxInt64, U: math.MaxUint64},
+			{I: math.MinInt64, U: 1 << 53},
+			{I: 1<<53 + 1, U: 1e19},
+		} {
+			b, err := r.Encode(v)
+			So(err, ShouldBeNil)
+			var rv BigInts
+			So(r.DecodeInto(b, &rv), ShouldBeNil)
+			So(rv, ShouldResemble, v)
+		}
+
+		b, err := r.Encode(BigInts{I: math.MaxInt64, U: math.MaxUint64})
+		So(err, ShouldBeNil)
+		So(string(b), ShouldEqual, `{"I":"9223372036854775807","U":"18446744073709551615","_struct_name":"reflectx.BigInts"}`)
+		b, err = r.Encode(BigInts{I: 1 << 53, U: 1e19})
+		So(err, ShouldBeNil)
+		So(string(b), ShouldEqual, `{"I":9007199254740992,"U":10000000000000000000,"_struct_name":"reflectx.BigInts"}`)
+
+		sum, err := r.Hash(BigInts{I: math.MaxInt64})
+		So(err, ShouldBeNil)
+		other, err := r.Hash(BigInts{I: math.MaxInt64 - 1})
+		So(err, ShouldBeNil)
+		So(bytes.Equal(other, sum), ShouldBeFalse)
+		sum, err = r.Hash(BigInts{U: math.MaxUint64})
+		So(err, ShouldBeNil)
+		other, err = r.Hash(BigInts{U: math.MaxUint64 - 1})
+		So(err, ShouldBeNil)
+		So(bytes.Equal(other, sum), ShouldBeFalse)
+	})
+}
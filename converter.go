@@ -0,0 +1,87 @@
+package reflectx
+
+import (
+	"reflect"
+	"sync"
+)
+
+// EncodeFunc converts v to string, v is not a pointer.
+type EncodeFunc func(v reflect.Value) (string, error)
+
+// DecodeFunc sets v by the string s, v is settable and not a pointer.
+type DecodeFunc func(s string, v reflect.Value) error
+
+type converter struct {
+	encode EncodeFunc
+	decode DecodeFunc
+	// builtin is true for the converters of time.Time and time.Duration,
+	// Reflector encodes them by the marshalers instead.
+	builtin bool
+}
+
+// converters is a registry of converters indexed by reflect.Type, the
+// converters of parent are looked up if not found.
+type converters struct {
+	m      sync.Map //map[reflect.Type]converter
+	parent *converters
+}
+
+var globalConverters = &converters{}
+
+func init() {
+	registerTimeConverters(globalConverters)
+}
+
+// RegisterConverter registers the converter of type t, which is used by SetValue,
+// StrToValue, ValueToStr, FormMapper, DefaultMapper and Reflector. Converters
+// registered to FormMapper or Reflector are prior to the ones registered here.
+// Struct types with a converter are leaves of the Mapper, converters should be
+// registered before the types are mapped.
+// time.Time and time.Duration have built-in converters, which convert them
+// by RFC3339 and time.ParseDuration, registering converters replaces them.
+//	RegisterConverter(reflect.TypeOf(time.Time{}),
+//		func(v reflect.Value) (string, error) {
+//			return v.Interface().(time.Time).Format(time.RFC3339), nil
+//		},
+//		func(s string, v reflect.Value) error {
+//			t, err := time.Parse(time.RFC3339, s)
+//			if err == nil {
+//				v.Set(reflect.ValueOf(t))
+//			}
+//			return err
+//		})
+func RegisterConverter(t reflect.Type, encode EncodeFunc, decode DecodeFunc) {
+	globalConverters.register(t, encode, decode)
+}
+
+func (cs *converters) register(t reflect.Type, encode EncodeFunc, decode DecodeFunc) {
+	if encode == nil || decode == nil {
+		panic("reflectx: nil converter for " + t.String())
+	}
+	cs.m.Store(Deref(t), converter{encode: encode, decode: decode})
+}
+
+// lookup returns the converter of t, the converters of cs are prior to the
+// global ones. cs may be nil.
+func (cs *converters) lookup(t reflect.Type) (converter, bool) {
+	for ; cs != nil; cs = cs.parent {
+		if c, ok := cs.m.Load(t); ok {
+			return c.(converter), true
+		}
+	}
+	if c, ok := globalConverters.m.Load(t); ok {
+		return c.(converter), true
+	}
+	return converter{}, false
+}
+
+// has returns whether t or the element of t has a converter.
+func (cs *converters) has(t reflect.Type) bool {
+	_, ok := cs.lookup(Deref(t))
+	return ok
+}
+
+// isLeaf returns whether t is a leaf of the mapping, which is not a struct or has a converter.
+func (cs *converters) isLeaf(t reflect.Type) bool {
+	return Deref(t).Kind() != reflect.Struct || cs.has(t)
+}
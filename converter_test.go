@@ -0,0 +1,154 @@
+package reflectx
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// Money is registered with the package level converter as "12.34".
+type Money struct {
+	Cents int64
+}
+
+func init() {
+	RegisterConverter(reflect.TypeOf(Money{}),
+		func(v reflect.Value) (string, error) {
+			m := v.Interface().(Money)
+			return fmt.Sprintf("%d.%02d", m.Cents/100, m.Cents%100), nil
+		},
+		func(s string, v reflect.Value) error {
+			parts := strings.SplitN(s, ".", 2)
+			if len(parts) != 2 || len(parts[1]) != 2 {
+				return errors.New("money: invalid " + s)
+			}
+			yuan, err := parseInt(parts[0], 64)
+			if err != nil {
+				return err
+			}
+			cents, err := parseInt(parts[1], 64)
+			if err != nil {
+				return err
+			}
+			v.Set(reflect.ValueOf(Money{yuan*100 + cents}))
+			return nil
+		})
+}
+
+const dateLayout = "2006-01-02"
+
+func encodeDate(v reflect.Value) (string, error) {
+	return v.Interface().(time.Time).Format(dateLayout), nil
+}
+
+func decodeDate(s string, v reflect.Value) error {
+	t, err := time.Parse(dateLayout, s)
+	if err == nil {
+		v.Set(reflect.ValueOf(t))
+	}
+	return err
+}
+
+type Order struct {
+	Price  Money `default:"1.50"`
+	Prices []Money
+	Tip    *Money
+	Date   time.Time
+}
+
+func TestConverter(t *testing.T) {
+	date := time.Date(2021, 3, 4, 0, 0, 0, 0, time.UTC)
+
+	Convey("should convert by the package level converter", t, func() {
+		var m Money
+		So(StrToValue("3.04", reflect.ValueOf(&m).Elem()), ShouldBeNil)
+		So(m, ShouldResemble, Money{304})
+
+		str, err := ValueToStr(reflect.ValueOf(&m))
+		So(err, ShouldBeNil)
+		So(str, ShouldEqual, "3.04")
+
+		var pm *Money
+		So(SetValue(reflect.ValueOf(&pm).Elem(), reflect.ValueOf("0.05")), ShouldBeNil)
+		So(*pm, ShouldResemble, Money{5})
+
+		var s string
+		So(SetValue(reflect.ValueOf(&s).Elem(), reflect.ValueOf(m)), ShouldBeNil)
+		So(s, ShouldEqual, "3.04")
+
+		So(StrToValue("3", reflect.ValueOf(&m).Elem()).Error(), ShouldEqual, "money: invalid 3")
+	})
+
+	Convey("should set default value by converter", t, func() {
+		var o Order
+		SetDefault(&o)
+		So(o.Price, ShouldResemble, Money{150})
+
+		o.Price = Money{1}
+		SetDefault(&o)
+		So(o.Price, ShouldResemble, Money{1})
+	})
+
+	Convey("should map form by converters", t, func() {
+		fm := NewFormMapper("", nil)
+		fm.RegisterConverter(reflect.TypeOf(time.Time{}), encodeDate, decodeDate)
+
+		var o Order
+		err := fm.FormToStruct(map[string][]string{
+			"Price":  {"2.00"},
+			"Prices": {"1.00", "0.10"},
+			"Tip":    {"0.01"},
+			"Date":   {"2021-03-04"},
+		}, &o)
+		So(err, ShouldBeNil)
+		So(o.Price, ShouldResemble, Money{200})
+		So(o.Prices, ShouldResemble, []Money{{100}, {10}})
+		So(*o.Tip, ShouldResemble, Money{1})
+		So(o.Date, ShouldResemble, date)
+
+		form := make(map[string][]string)
+		fm.StructToForm(o, form)
+		So(form, ShouldResemble, map[string][]string{
+			"Price":  {"2.00"},
+			"Prices": {"1.00", "0.10"},
+			"Tip":    {"0.01"},
+			"Date":   {"2021-03-04"},
+		})
+
+		So(fm.FormToStruct(map[string][]string{"Date": {"today"}}, &o), ShouldNotBeNil)
+	})
+
+	for _, format := range []string{"json", "bson"} {
+		r := NewReflector(format, "", nil)
+		r.Register(Order{})
+		r.RegisterConverter(reflect.TypeOf(time.Time{}), encodeDate, decodeDate)
+
+		Convey("should encode and decode by converters with "+format, t, func() {
+			tip := Money{1}
+			o := Order{Price: Money{200}, Prices: []Money{{100}}, Tip: &tip, Date: date}
+			data, err := r.Encode(o)
+			So(err, ShouldBeNil)
+
+			var got Order
+			So(r.DecodeInto(data, &got), ShouldBeNil)
+			So(got, ShouldResemble, o)
+
+			rv, err := r.Decode(data)
+			So(err, ShouldBeNil)
+			So(rv, ShouldResemble, o)
+		})
+	}
+
+	Convey("should encode converted values as string", t, func() {
+		r := NewReflector("json", "", nil, OmitStaticName())
+		r.RegisterConverter(reflect.TypeOf(time.Time{}), encodeDate, decodeDate)
+		data, err := r.Encode(Order{Price: Money{200}, Date: date})
+		So(err, ShouldBeNil)
+		So(string(data), ShouldEqual, `{"Date":"2021-03-04","Price":"2.00","_struct_name":"reflectx.Order"}`)
+	})
+}
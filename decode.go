@@ -0,0 +1,666 @@
+package reflectx
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DecodeError describes a value which can not be decoded by Reflector.
+type DecodeError struct {
+	// Path is the JSON pointer of the value, such as "/Items/0/Name", it is
+	// empty for the top level value. The keys wrapping the fields of structs,
+	// such as the value key of WithEnvelope, are included.
+	Path     string
+	Expected reflect.Type // the type to decode into, nil if unknown.
+	Got      reflect.Type // the type of Value, nil if Value is nil.
+	Value    interface{}  // the raw value unmarshaled from bytes.
+	Err      error
+}
+
+func (e *DecodeError) Error() string {
+	if e.Path == "" {
+		return e.Err.Error()
+	}
+	return e.Err.Error() + " at " + e.Path
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// LimitError is returned if the decoding value exceeds a limit set by
+// WithMaxDepth, WithMaxElements or WithMaxLength.
+type LimitError struct {
+	Limit string // "depth", "elements" or "length".
+	Max   int
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("reflectx: exceeded max %s %d", e.Limit, e.Max)
+}
+
+// NotAllowedError is returned if the struct name is not allowed by AllowTypes.
+type NotAllowedError struct {
+	Name string
+}
+
+func (e *NotAllowedError) Error() string {
+	return fmt.Sprintf("reflectx: type %q is not allowed", e.Name)
+}
+
+// DecodeErrors is returned if all errors are collected by CollectErrors,
+// they are sorted by paths.
+type DecodeErrors []*DecodeError
+
+func (es DecodeErrors) Error() string {
+	msgs := make([]string, len(es))
+	for i, e := range es {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// decodeState holds the state of decoding a value by Reflector.
+type decodeState struct {
+	reflector
+	// the pointers decoded by IDKey and the raw values marked with IDKey,
+	// only used with KeepReferences.
+	refs map[int]reflect.Value
+	raws map[int]map[string]interface{}
+	// the keys and indexes from the top level to the decoding value.
+	path []string
+	// the errors collected by CollectErrors.
+	errs DecodeErrors
+}
+
+func newDecodeState(r reflector, val interface{}) (*decodeState, error) {
+	d := &decodeState{reflector: r}
+	if r.keepRefs {
+		d.refs = make(map[int]reflect.Value)
+		d.raws = make(map[int]map[string]interface{})
+	}
+	if r.keepRefs || r.maxDepth > 0 || r.maxElements > 0 || r.maxLength > 0 {
+		elements := 0
+		if err := d.scan(val, 0, &elements); err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+// push appends a key or index to the path.
+func (d *decodeState) push(key string) {
+	d.path = append(d.path, key)
+}
+
+func (d *decodeState) pop() {
+	d.path = d.path[:len(d.path)-1]
+}
+
+// pushWrapper pushes the key that wraps the fields of the struct name, and
+// returns the function to pop it.
+func (d *decodeState) pushWrapper(name string) func() {
+	key := d.wrapperKey(name)
+	if key == "" {
+		return func() {}
+	}
+	d.push(key)
+	return d.pop
+}
+
+// jsonPointer returns the path as a JSON pointer defined by RFC 6901.
+func (d *decodeState) jsonPointer() string {
+	var sb strings.Builder
+	for _, key := range d.path {
+		sb.WriteByte('/')
+		sb.WriteString(strings.Replace(strings.Replace(key, "~", "~0", -1), "/", "~1", -1))
+	}
+	return sb.String()
+}
+
+// fail converts err to *DecodeError with the current path. If all errors are
+// collected, it returns nil to go on decoding.
+func (d *decodeState) fail(err error, expected reflect.Type, val interface{}) error {
+	de, ok := err.(*DecodeError)
+	if !ok {
+		de = &DecodeError{
+			Path:     d.jsonPointer(),
+			Expected: expected,
+			Got:      reflect.TypeOf(val),
+			Value:    val,
+			Err:      err,
+		}
+		if d.collectErrors {
+			d.errs = append(d.errs, de)
+		}
+	}
+	if d.collectErrors {
+		return nil
+	}
+	return de
+}
+
+// result returns err, or the collected errors sorted by paths if err is nil.
+func (d *decodeState) result(err error) error {
+	if err == nil && len(d.errs) > 0 {
+		sort.SliceStable(d.errs, func(i, j int) bool {
+			return d.errs[i].Path < d.errs[j].Path
+		})
+		return d.errs
+	}
+	return err
+}
+
+// scan checks the limits of val before decoding, and finds all the values
+// marked with IDKey, so that a reference can be decoded before the value it
+// refers to.
+func (d *decodeState) scan(val interface{}, depth int, elements *int) error {
+	switch vv := val.(type) {
+	case map[string]interface{}:
+		if err := d.checkContainer(vv, depth+1, elements, len(vv)); err != nil {
+			return err
+		}
+		if d.keepRefs {
+			if id := d.id(vv); id != 0 {
+				d.raws[id] = vv
+			}
+		}
+		for k, v := range vv {
+			d.push(k)
+			if err := d.checkLength(k, len(k)); err != nil {
+				return err
+			}
+			if err := d.scan(v, depth+1, elements); err != nil {
+				return err
+			}
+			d.pop()
+		}
+	case []interface{}:
+		if err := d.checkContainer(vv, depth+1, elements, len(vv)); err != nil {
+			return err
+		}
+		for i, v := range vv {
+			d.push(strconv.Itoa(i))
+			if err := d.scan(v, depth+1, elements); err != nil {
+				return err
+			}
+			d.pop()
+		}
+	case string:
+		return d.checkLength(vv, len(vv))
+	case json.Number:
+		return d.checkLength(vv, len(vv))
+	case []byte:
+		return d.checkLength(vv, len(vv))
+	}
+	return nil
+}
+
+// checkContainer checks the depth of a map or slice, and the total number of elements.
+func (d *decodeState) checkContainer(val interface{}, depth int, elements *int, n int) error {
+	*elements += n
+	switch {
+	case d.maxDepth > 0 && depth > d.maxDepth:
+		return d.limitError(val, "depth", d.maxDepth)
+	case d.maxElements > 0 && *elements > d.maxElements:
+		return d.limitError(val, "elements", d.maxElements)
+	}
+	return nil
+}
+
+func (d *decodeState) checkLength(val interface{}, n int) error {
+	if d.maxLength > 0 && n > d.maxLength {
+		return d.limitError(val, "length", d.maxLength)
+	}
+	return nil
+}
+
+// limitError returns *DecodeError, it is never collected by CollectErrors.
+func (d *decodeState) limitError(val interface{}, limit string, max int) error {
+	return &DecodeError{
+		Path:  d.jsonPointer(),
+		Got:   reflect.TypeOf(val),
+		Value: val,
+		Err:   &LimitError{Limit: limit, Max: max},
+	}
+}
+
+// nameMap returns the StructMap of the name if it is allowed by AllowTypes.
+func (d *decodeState) nameMap(name string) (StructMap, error) {
+	if d.allowed != nil && !d.allowed[name] {
+		return StructMap{}, &NotAllowedError{Name: name}
+	}
+	sm, ok := d.mapper.NameMap(name)
+	if !ok {
+		return sm, errors.New("reflectx: unknown struct name: " + name)
+	}
+	return sm, nil
+}
+
+// id returns the value of IDKey in the fields of mp, or 0 if not found.
+func (d *decodeState) id(mp map[string]interface{}) int {
+	_, fields := d.structName(mp)
+	if v, ok := fields[IDKey]; ok {
+		return ValueOf(v).Int()
+	}
+	return 0
+}
+
+// refID returns the id if val is a reference like {"$ref": id}.
+func refID(val interface{}) (int, bool) {
+	mp, ok := val.(map[string]interface{})
+	if !ok || len(mp) != 1 {
+		return 0, false
+	}
+	v, ok := mp[RefKey]
+	if !ok {
+		return 0, false
+	}
+	return ValueOf(v).Int(), true
+}
+
+// pointer returns the pointer with type typ registered by id.
+// If the pointer is not decoded yet, it is allocated and decoded.
+func (d *decodeState) pointer(id int, typ reflect.Type) (reflect.Value, error) {
+	if ptr, ok := d.refs[id]; ok {
+		if ptr.Type() != typ {
+			return ptr, fmt.Errorf("reflectx: type mismatch, expected %v, got %v", typ, ptr.Type())
+		}
+		return ptr, nil
+	}
+
+	raw, ok := d.raws[id]
+	if !ok {
+		return reflect.Value{}, fmt.Errorf("reflectx: unknown reference id %d", id)
+	}
+	// register before decoding, the value may refer to itself.
+	ptr := reflect.New(typ.Elem())
+	d.refs[id] = ptr
+	return ptr, d.decodeInto(raw, ptr.Elem())
+}
+
+// namedPointer is the same as pointer, but the type is found by the struct name of the raw value.
+func (d *decodeState) namedPointer(id int) (reflect.Value, error) {
+	if ptr, ok := d.refs[id]; ok {
+		return ptr, nil
+	}
+
+	raw, ok := d.raws[id]
+	if !ok {
+		return reflect.Value{}, fmt.Errorf("reflectx: unknown reference id %d", id)
+	}
+	name, _ := d.structName(raw)
+	sm, err := d.nameMap(name)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	return d.pointer(id, reflect.PtrTo(Deref(sm.Tree.Type)))
+}
+
+// refPointer returns the id of val if it is a reference or marked with IDKey.
+func (d *decodeState) refPointer(val interface{}) int {
+	if !d.keepRefs {
+		return 0
+	}
+	if id, ok := refID(val); ok {
+		return id
+	}
+	if mp, ok := val.(map[string]interface{}); ok {
+		return d.id(mp)
+	}
+	return 0
+}
+
+// decode decodes a interface{} to reflect.Value.
+// The name of the struct store in the map with StructNameKey.
+func (d *decodeState) decode(val interface{}) (rv interface{}, err error) {
+	switch vv := val.(type) {
+	case map[string]interface{}:
+		if len(vv) == 0 {
+			return vv, nil
+		}
+		if id := d.refPointer(vv); id != 0 {
+			ptr, err := d.namedPointer(id)
+			if err != nil {
+				return nil, d.fail(err, nil, vv)
+			}
+			return ptr.Interface(), nil
+		}
+		structName, fields := d.structName(vv)
+		if structName == "" {
+			mp := make(map[string]interface{}, len(vv))
+			for k, v := range vv {
+				d.push(k)
+				mp[k], err = d.decode(v)
+				d.pop()
+				if err != nil {
+					return nil, err
+				}
+			}
+			return mp, nil
+		}
+		sm, err := d.nameMap(structName)
+		if err != nil {
+			return nil, d.fail(err, nil, vv)
+		}
+		defer d.pushWrapper(structName)()
+		return d.mapToStruct(fields, &sm)
+	case []interface{}:
+		if len(vv) == 0 {
+			return vv, nil
+		}
+		s := make([]interface{}, len(vv))
+		for i := 0; i < len(vv); i++ {
+			d.push(strconv.Itoa(i))
+			s[i], err = d.decode(vv[i])
+			d.pop()
+			if err != nil {
+				return nil, err
+			}
+		}
+		return s, nil
+	default:
+		return vv, nil
+	}
+}
+
+// mapToStruct converts a map[string]interface{} to a struct.
+// The name of the struct store in the map with StructNameKey.
+func (d *decodeState) mapToStruct(mp map[string]interface{}, sm *StructMap) (interface{}, error) {
+	structV := Alloc(sm.Tree.Type)
+	if ok, err := d.unmarshalValue(mp, reflect.Indirect(structV)); ok {
+		if err != nil {
+			return nil, d.fail(err, sm.Tree.Type, mp)
+		}
+		return structV.Interface(), nil
+	}
+	if err := d.decodeStruct(mp, reflect.Indirect(structV)); err != nil {
+		return nil, err
+	}
+	return structV.Interface(), nil
+}
+
+// decodeInto decodes val to field according to the static type of field.
+// The name of the struct stored with StructNameKey is only used if the type
+// of field is interface{}, otherwise it is checked to match the field type.
+func (d *decodeState) decodeInto(val interface{}, field reflect.Value) error {
+	if err := d.decodeValue(val, field); err != nil {
+		return d.fail(err, field.Type(), val)
+	}
+	return nil
+}
+
+func (d *decodeState) decodeValue(val interface{}, field reflect.Value) error {
+	if val == nil {
+		// nil field
+		return nil
+	}
+
+	if k := field.Kind(); k != reflect.Ptr && k != reflect.Interface {
+		if c, ok := d.convs.lookup(field.Type()); ok && !c.builtin {
+			return setValue(field, reflect.ValueOf(val), d.convs)
+		}
+		if ok, err := d.unmarshalValue(val, field); ok {
+			return err
+		}
+	}
+
+	switch field.Kind() {
+	case reflect.Ptr:
+		if id := d.refPointer(val); id != 0 {
+			ptr, err := d.pointer(id, field.Type())
+			if err != nil {
+				return err
+			}
+			field.Set(ptr)
+			return nil
+		}
+		return d.decodeInto(val, AllocIndirect(field))
+	case reflect.Interface:
+		return d.decodeInterface(val, field)
+	case reflect.Struct:
+		if id, ok := refID(val); ok && d.keepRefs {
+			// copy the value of the reference.
+			ptr, err := d.pointer(id, reflect.PtrTo(field.Type()))
+			if err != nil {
+				return err
+			}
+			field.Set(ptr.Elem())
+			return nil
+		}
+		mp, ok := val.(map[string]interface{})
+		if !ok {
+			// type mismatch unless they have the same type.
+			return setValue(field, reflect.ValueOf(val), d.convs)
+		}
+		name, fields := d.structName(mp)
+		if name != "" && name != field.Type().String() {
+			return fmt.Errorf("reflectx: type mismatch, expected %v, got %v", field.Type(), name)
+		}
+		if id := d.refPointer(mp); id != 0 && field.CanAddr() {
+			// register before decoding, such as the top level struct of
+			// DecodeInto, so that the references point to field.
+			if _, ok := d.refs[id]; !ok {
+				d.refs[id] = field.Addr()
+			}
+		}
+		defer d.pushWrapper(name)()
+		return d.decodeStruct(fields, field)
+	case reflect.Slice:
+		s, ok := val.([]interface{})
+		if !ok && d.singleToSlice {
+			s, ok = []interface{}{val}, true
+		}
+		if !ok {
+			return setValue(field, reflect.ValueOf(val), d.convs)
+		}
+		slice := reflect.MakeSlice(field.Type(), len(s), len(s))
+		for i := range s {
+			d.push(strconv.Itoa(i))
+			err := d.decodeInto(s[i], slice.Index(i))
+			d.pop()
+			if err != nil {
+				return err
+			}
+		}
+		field.Set(slice)
+		return nil
+	case reflect.Array:
+		s, ok := val.([]interface{})
+		if !ok {
+			return setValue(field, reflect.ValueOf(val), d.convs)
+		}
+		if len(s) != field.Len() {
+			return fmt.Errorf("reflectx: expected %d elements for %v, got %d", field.Len(), field.Type(), len(s))
+		}
+		for i := range s {
+			d.push(strconv.Itoa(i))
+			err := d.decodeInto(s[i], field.Index(i))
+			d.pop()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Map:
+		mp, ok := val.(map[string]interface{})
+		if !ok {
+			return setValue(field, reflect.ValueOf(val), d.convs)
+		}
+		fT := field.Type()
+		m := reflect.MakeMapWithSize(fT, len(mp))
+		for k, v := range mp {
+			d.push(k)
+			key := reflect.New(fT.Key()).Elem()
+			if err := d.mapKey(k, key); err != nil {
+				err = d.fail(err, fT.Key(), k)
+				d.pop()
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			elem := reflect.New(fT.Elem()).Elem()
+			err := d.decodeInto(v, elem)
+			d.pop()
+			if err != nil {
+				return err
+			}
+			m.SetMapIndex(key, elem)
+		}
+		field.Set(m)
+		return nil
+	default:
+		return setValue(field, reflect.ValueOf(val), d.convs)
+	}
+}
+
+// mapKey sets key by the string encoded by encodeState.mapKey.
+func (d *decodeState) mapKey(k string, key reflect.Value) error {
+	keyT := key.Type()
+	switch {
+	case d.convs.has(keyT), keyT.Kind() == reflect.String, implementsOf(keyT)&implTextUnmarshaler != 0:
+	case Deref(keyT).Kind() == reflect.Struct, keyT.Kind() == reflect.Array:
+		var val interface{}
+		if err := unmarshalJSON([]byte(k), &val); err != nil {
+			return err
+		}
+		return d.decodeValue(val, key)
+	}
+	return setValue(key, reflect.ValueOf(k), d.convs)
+}
+
+// decodeInterface decodes val to the interface field.
+// If implementations of the interface are registered, only the registered
+// structs can be decoded, otherwise the struct is found by name, and it must
+// implement the interface.
+func (d *decodeState) decodeInterface(val interface{}, field reflect.Value) error {
+	fT := field.Type()
+	if impls, ok := d.ifaces.Load(fT); ok {
+		mp, ok := val.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("reflectx: type mismatch, expected %v, got %T", fT, val)
+		}
+		id := d.refPointer(mp)
+		if id != 0 {
+			// the name is in the value the reference refers to.
+			if raw, ok := d.raws[id]; ok {
+				mp = raw
+			}
+		}
+		name, fields := d.structName(mp)
+		if d.allowed != nil && !d.allowed[name] {
+			return &NotAllowedError{Name: name}
+		}
+		implT, ok := impls.(map[string]reflect.Type)[name]
+		if !ok {
+			return fmt.Errorf("reflectx: %q is not a registered implementation of %v", name, fT)
+		}
+
+		var implV reflect.Value
+		if id != 0 {
+			ptr, err := d.pointer(id, reflect.PtrTo(Deref(implT)))
+			if err != nil {
+				return err
+			}
+			implV = ptr
+			if implT.Kind() != reflect.Ptr {
+				implV = ptr.Elem()
+			}
+		} else {
+			implV = Alloc(implT)
+			pop := d.pushWrapper(name)
+			err := d.decodeStruct(fields, reflect.Indirect(implV))
+			pop()
+			if err != nil {
+				return err
+			}
+		}
+		field.Set(implV)
+		return nil
+	}
+
+	rv, err := d.decode(val)
+	if err != nil || rv == nil {
+		// rv is nil if the errors are collected.
+		return err
+	}
+	v := reflect.ValueOf(rv)
+	if !v.Type().Implements(fT) {
+		if !reflect.PtrTo(v.Type()).Implements(fT) {
+			return fmt.Errorf("reflectx: %v does not implement %v", v.Type(), fT)
+		}
+		ptr := reflect.New(v.Type())
+		ptr.Elem().Set(v)
+		v = ptr
+	}
+	field.Set(v)
+	return nil
+}
+
+// decodeStruct sets the fields of structV by the keys of mp.
+// structV must be a settable struct value.
+func (d *decodeState) decodeStruct(mp map[string]interface{}, structV reflect.Value) error {
+	structT := structV.Type()
+	sm := d.mapper.TypeMap(structT)
+	remainFi := remainField(sm.Tree)
+	var remain map[string]interface{}
+	for k, v := range mp {
+		if k == d.nameKey && d.nameStyle == propertyName {
+			continue
+		}
+		if k == IDKey && d.keepRefs {
+			continue
+		}
+
+		fi := sm.GetByPath(k)
+		if fi == nil {
+			// the remain field collects the keys it is encoded to, whatever
+			// the policy is.
+			if remainFi != nil {
+				if remain == nil {
+					remain = make(map[string]interface{})
+				}
+				remain[k] = v
+				continue
+			}
+			if d.unknownFields != StrictUnknownFields {
+				continue
+			}
+			d.push(k)
+			err := d.fail(errors.New("reflectx: "+k+" is not a path in struct "+structT.String()), nil, v)
+			d.pop()
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		d.push(k)
+		err := d.decodeInto(v, FieldByIndexes(structV, fi.Index))
+		d.pop()
+		if err != nil {
+			return err
+		}
+	}
+
+	if remain != nil {
+		return d.decodeInto(remain, FieldByIndexes(structV, remainFi.Index))
+	}
+	return nil
+}
+
+// remainField returns the child of fi with the "remain" option, or nil if not found.
+func remainField(fi *FieldInfo) *FieldInfo {
+	for _, child := range fi.Children {
+		if _, ok := child.Options[Remain]; ok {
+			return child
+		}
+	}
+	return nil
+}
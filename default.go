@@ -52,8 +52,12 @@ func NewDefaultMapper(tagName string, tagFunc TagFunc) *DefaultMapper {
 	if tagFunc == nil {
 		tagFunc = DefaultTagFunc
 	}
+	mapper := NewMapper(tagName, tagFunc)
+	mapper.fieldFunc = func(fi *FieldInfo) {
+		setTimeOptions(fi, nil)
+	}
 	return &DefaultMapper{
-		mapper: NewMapper(tagName, tagFunc),
+		mapper: mapper,
 	}
 }
 
@@ -62,6 +66,8 @@ func NewDefaultMapper(tagName string, tagFunc TagFunc) *DefaultMapper {
 //		Field string `default:"some string"`
 //		Slice []int `default:"1,2,3,4,5"`
 //		Map map[string]int`default:"x=1,y=2,z=3"`
+//		Timeout time.Duration `default:"5s"`
+//		Since time.Time `default:"2024-01-01,layout=DateOnly"`
 //	}
 // Note that the zero value of slice is nil, not []int{}.
 func SetDefault(ptr interface{}) {
@@ -85,15 +91,16 @@ func (dm *DefaultMapper) SetDefault(ptr interface{}) {
 
 	for _, df := range ds.fields {
 		v := val.Field(df.index[0])
-		switch v.Kind() {
-		case reflect.Ptr:
+		// the struct with converter is set as a normal kind.
+		switch kind := v.Kind(); {
+		case kind == reflect.Ptr:
 			if v.IsNil() {
 				v.Set(df.defaultVal)
-			} else if v.Elem().Kind() == reflect.Struct {
+			} else if !globalConverters.isLeaf(v.Type()) {
 				// skip the non-nil point of normal kind
 				dm.SetDefault(v.Interface())
 			}
-		case reflect.Struct:
+		case kind == reflect.Struct && !globalConverters.has(v.Type()):
 			dm.SetDefault(v.Addr().Interface())
 		default:
 			// skip the non-zero field, set it to default value
@@ -132,7 +139,8 @@ func (dm *DefaultMapper) getDefaultStruct(typ reflect.Type) defaultStruct {
 
 	for _, fi := range structMap.Tree.Children {
 		fT := Deref(fi.Type)
-		if fT.Kind() != reflect.Struct && len(fi.Parts) == 0 {
+		conv := globalConverters.has(fT)
+		if (fT.Kind() != reflect.Struct || conv) && len(fi.Parts) == 0 {
 			// skip the nromal field which doesn't have default tag.
 			continue
 		}
@@ -144,8 +152,8 @@ func (dm *DefaultMapper) getDefaultStruct(typ reflect.Type) defaultStruct {
 		}
 		dv := reflect.Indirect(df.defaultVal)
 		// set default value to df.defaultVal
-		switch fT.Kind() {
-		case reflect.Struct:
+		switch kind := fT.Kind(); {
+		case kind == reflect.Struct && !conv:
 			child := dm.getDefaultStruct(fT)
 			if len(child.fields) == 0 {
 				// In this case, the child struct doesn't have any default tags.
@@ -153,7 +161,7 @@ func (dm *DefaultMapper) getDefaultStruct(typ reflect.Type) defaultStruct {
 				continue
 			}
 			dv.Set(child.defaultVal)
-		case reflect.Map:
+		case kind == reflect.Map && !conv:
 			dv.Set(reflect.MakeMapWithSize(fT, len(fi.Options)))
 			for k, v := range fi.Options {
 				// parse key of map
@@ -168,7 +176,7 @@ func (dm *DefaultMapper) getDefaultStruct(typ reflect.Type) defaultStruct {
 				}
 				dv.SetMapIndex(kv, vv)
 			}
-		case reflect.Slice:
+		case kind == reflect.Slice && !conv:
 			numElems := len(fi.Parts)
 			dv.Set(reflect.MakeSlice(fT, numElems, numElems))
 			// only the key of Options is useful.
@@ -178,7 +186,8 @@ func (dm *DefaultMapper) getDefaultStruct(typ reflect.Type) defaultStruct {
 				}
 			}
 		default:
-			if err := StrToValue(fi.Parts[0], dv); err != nil {
+			// the time options like "layout" follow the default value.
+			if err := strToValue(fi.Parts[0], dv, fieldConverters(fi, nil)); err != nil {
 				panic(err)
 			}
 		}
@@ -0,0 +1,300 @@
+package reflectx
+
+import (
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"sort"
+)
+
+// encodeState holds the state of encoding a value by Reflector.
+type encodeState struct {
+	reflector
+	// ids of the encoded pointers, only used with KeepReferences.
+	ids map[pointerKey]int
+	// the first error returned by marshalers.
+	err error
+}
+
+// the same address may be shared by a struct and its first field.
+type pointerKey struct {
+	addr uintptr
+	typ  reflect.Type
+}
+
+func newEncodeState(r reflector) *encodeState {
+	e := &encodeState{reflector: r}
+	if r.keepRefs {
+		e.ids = make(map[pointerKey]int)
+	}
+	return e
+}
+
+func (e *encodeState) setErr(err error) {
+	if e.err == nil {
+		e.err = err
+	}
+}
+
+//encode encodes a struct to map[string]interface{}, mark the name of the struct by the style of r.
+func (e *encodeState) encode(fi *FieldInfo, val reflect.Value) interface{} {
+	if val.Kind() == reflect.Interface {
+		//get the real type of the interface
+		val = reflect.ValueOf(val.Interface())
+	}
+
+	fT, fV, addr := getField(fi, val)
+	//skip invalid value or nil ptr.
+	if !fV.IsValid() {
+		return nil
+	}
+
+	if c, ok := e.convs.lookup(fT); ok && !c.builtin {
+		str, err := c.encode(fV)
+		if err != nil {
+			e.setErr(err)
+			return nil
+		}
+		return str
+	}
+
+	// the type of field is known if fi is not nil or an interface field.
+	static := fi != nil && Deref(fi.Type) == fT
+	if rv, ok := e.marshalValue(fT, fV, static); ok {
+		return rv
+	}
+
+	switch fT.Kind() {
+	case reflect.Struct:
+		id := 0
+		if e.keepRefs && addr != 0 {
+			key := pointerKey{addr, fT}
+			if id, ok := e.ids[key]; ok {
+				return map[string]interface{}{RefKey: id}
+			}
+			id = len(e.ids) + 1
+			e.ids[key] = id
+			// the children of recursive field are ignored by the mapper, use the
+			// mapping of the struct itself.
+			fi = nil
+		}
+
+		if fi == nil || !static {
+			fi = e.mapper.TypeMap(fT).Tree
+			val = fV
+		}
+		mp := make(map[string]interface{}, len(fi.Children)+2)
+		var remain map[string]interface{}
+		for _, child := range fi.Children {
+			if omitField(child, val) {
+				continue
+			}
+			if elem := e.encode(child, val); elem != nil {
+				if _, ok := child.Options[Remain]; ok {
+					if rm, ok := elem.(map[string]interface{}); ok {
+						remain = rm
+						continue
+					}
+				}
+				mp[child.Name] = elem
+			}
+		}
+		// the keys of the remain field do not override the fields.
+		for k, v := range remain {
+			if _, ok := mp[k]; !ok {
+				mp[k] = v
+			}
+		}
+		if id != 0 {
+			mp[IDKey] = id
+		}
+		// the name of a value with id is kept, a reference to it may be decoded
+		// before it by an interface{} field.
+		if static && e.omitStaticName && id == 0 {
+			return mp
+		}
+		return e.markName(fT.String(), mp)
+	case reflect.Slice:
+		numElems := fV.Len()
+		elemT := Deref(fT.Elem())
+		if numElems == 0 {
+			if e.keepEmpty && !fV.IsNil() {
+				return []interface{}{}
+			}
+			return nil
+		}
+		var elemFi *FieldInfo
+		if elemT.Kind() == reflect.Struct {
+			elemFi = e.mapper.TypeMap(elemT).Tree
+		}
+		var slice []interface{}
+		for i := 0; i < numElems; i++ {
+			// append nil elem or not?
+			elem := e.encode(elemFi, fV.Index(i))
+			slice = append(slice, elem)
+		}
+		return slice
+	case reflect.Map:
+		keyT := fT.Key()
+		elemT := Deref(fT.Elem())
+		numElems := fV.Len()
+		if numElems == 0 && (!e.keepEmpty || fV.IsNil()) {
+			return nil
+		}
+
+		// the keys are stringified, so that they are supported by json and bson.
+		mp := make(map[string]interface{}, numElems)
+		var elemFi *FieldInfo
+		if elemT.Kind() == reflect.Struct {
+			elemFi = e.mapper.TypeMap(elemT).Tree
+		}
+
+		keys := make([]string, 0, numElems)
+		vals := make(map[string]reflect.Value, numElems)
+		for _, k := range fV.MapKeys() {
+			key, err := e.mapKey(keyT, k)
+			if err != nil {
+				e.setErr(err)
+				continue
+			}
+			keys = append(keys, key)
+			vals[key] = fV.MapIndex(k)
+		}
+		if e.keepRefs {
+			// encode in order of keys, so that the ids of references are stable.
+			sort.Strings(keys)
+		}
+		for _, key := range keys {
+			elem := e.encode(elemFi, vals[key])
+			if elem == nil && !e.keepNilElems {
+				continue
+			}
+			mp[key] = elem
+		}
+		if len(mp) == 0 && !e.keepEmpty {
+			return nil
+		}
+		return mp
+	default:
+		return fV.Interface()
+	}
+}
+
+// mapKey converts the key of map to string, in order of the converter, the
+// string kinds, encoding.TextMarshaler and the numbers or bools. The other
+// types such as structs and arrays are encoded by Reflector, and then
+// marshaled to compact json.
+func (e *encodeState) mapKey(keyT reflect.Type, k reflect.Value) (string, error) {
+	if c, ok := e.convs.lookup(keyT); ok {
+		return c.encode(k)
+	}
+	if keyT.Kind() == reflect.String {
+		return k.String(), nil
+	}
+	if implementsOf(keyT)&implTextMarshaler != 0 {
+		b, err := addrOf(k).Interface().(encoding.TextMarshaler).MarshalText()
+		return string(b), err
+	}
+	if str, err := valueToStr(k, e.convs); err == nil {
+		return str, nil
+	}
+
+	var fi *FieldInfo
+	if Deref(keyT).Kind() == reflect.Struct {
+		fi = e.mapper.TypeMap(Deref(keyT)).Tree
+	}
+	b, err := json.Marshal(e.encode(fi, k))
+	return string(b), err
+}
+
+// omitField returns whether the field specified by fi should be skipped by
+// the "omitempty" or "omitzero" option.
+func omitField(fi *FieldInfo, val reflect.Value) bool {
+	_, empty := fi.Options[OmitEmpty]
+	_, zero := fi.Options[OmitZero]
+	if !empty && !zero {
+		return false
+	}
+	fV := FieldByIndexesReadOnly(val, fi.Index)
+	if !fV.IsValid() {
+		return true
+	}
+	return (empty && isEmptyValue(fV)) || (zero && isZeroValue(fV))
+}
+
+// isEmptyValue returns whether v is empty as defined by encoding/json, that is
+// false, 0, a nil pointer, a nil interface value, and any empty array, slice,
+// map, or string. Note that a struct is never empty.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
+
+// isZeroer is implemented by types like time.Time.
+type isZeroer interface {
+	IsZero() bool
+}
+
+var isZeroerType = reflect.TypeOf((*isZeroer)(nil)).Elem()
+
+// isZeroValue returns whether v is the zero value of its type, or the IsZero
+// method of v returns true.
+func isZeroValue(v reflect.Value) bool {
+	if v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return true
+		}
+	}
+	if v.Type().Implements(isZeroerType) {
+		return v.Interface().(isZeroer).IsZero()
+	}
+	if v.CanAddr() && v.Addr().Type().Implements(isZeroerType) {
+		return v.Addr().Interface().(isZeroer).IsZero()
+	}
+	return v.IsZero()
+}
+
+// getField returns the type and value of the field specified by fi, pointers
+// and interfaces are dereferenced. addr is the address the field points to,
+// or 0 if it is not a pointer.
+func getField(fi *FieldInfo, val reflect.Value) (fT reflect.Type, fV reflect.Value, addr uintptr) {
+	if fi != nil {
+		fV = FieldByIndexesReadOnly(val, fi.Index)
+	} else {
+		fV = val
+	}
+	if fV.Kind() == reflect.Ptr && !fV.IsNil() {
+		addr = fV.Pointer()
+	}
+	fV = reflect.Indirect(fV)
+	//skip invalid value or nil ptr.
+	if fV.IsValid() {
+		fT = fV.Type()
+		if fT.Kind() == reflect.Interface {
+			//get the real type of the interface, fV may be invalid because fV.Interface() may be nil.
+			fV = reflect.ValueOf(fV.Interface())
+			if fV.Kind() == reflect.Ptr && !fV.IsNil() {
+				addr = fV.Pointer()
+			}
+			fV = reflect.Indirect(fV)
+			if !fV.IsValid() {
+				return nil, fV, 0
+			}
+			fT = fV.Type()
+		}
+	}
+	return
+}
@@ -1,25 +1,162 @@
 package reflectx
 
 import (
+	"errors"
+	"fmt"
+	"net/http"
 	"reflect"
+	"sort"
+	"strconv"
+	"strings"
 )
 
 var (
 	formMapper = NewFormMapper("", nil)
 )
 
+// KeySyntax is the syntax of the form keys of slice elements, map entries
+// and the fields of them.
+type KeySyntax int
+
+const (
+	// BracketKeys is the default syntax, for example:
+	//	items[0][name]=a&meta[color]=red
+	BracketKeys KeySyntax = iota
+	// DotKeys uses dots to separate the indexes and keys, for example:
+	//	items.0.name=a&meta.color=red
+	DotKeys
+)
+
+// BindError describes a form key which can not be bound to the field.
+type BindError struct {
+	Key   string       // the key of form, such as "items[0][qty]".
+	Path  string       // the path of the field, such as "items.0.qty".
+	Input []string     // the raw values of the key, or the names of files.
+	Type  reflect.Type // the type to bind into, nil if unknown.
+	Err   error        // the reason.
+}
+
+func (e *BindError) Error() string {
+	reason := strings.TrimPrefix(e.Err.Error(), "reflectx: ")
+	if e.Type == nil {
+		return fmt.Sprintf("reflectx: can not bind %s: %s", e.Key, reason)
+	}
+	return fmt.Sprintf("reflectx: can not bind %s to %v: %s", e.Key, e.Type, reason)
+}
+
+func (e *BindError) Unwrap() error {
+	return e.Err
+}
+
+// BindErrors is returned by FormToStruct with all the keys failed to bind,
+// sorted by the keys.
+type BindErrors []*BindError
+
+func (es BindErrors) Error() string {
+	msgs := make([]string, len(es))
+	for i, e := range es {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// err returns es sorted by keys, or nil if es is empty.
+func (es BindErrors) err() error {
+	if len(es) == 0 {
+		return nil
+	}
+	sort.Slice(es, func(i, j int) bool {
+		return es[i].Key < es[j].Key
+	})
+	return es
+}
+
+// newBindError returns *BindError of the key, err is returned by bindPath.
+func newBindError(key string, segs []string, input []string, err error) *BindError {
+	be, ok := err.(*BindError)
+	if !ok {
+		be = &BindError{Err: err}
+	}
+	be.Key = key
+	be.Path = strings.Join(segs, ".")
+	be.Input = input
+	return be
+}
+
+// typeError returns *BindError with the type t, which is completed by newBindError.
+func typeError(t reflect.Type, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &BindError{Type: t, Err: err}
+}
+
+// defaultMaxIndex is the default max index of the slice elements in form keys.
+const defaultMaxIndex = 1000
+
 type FormMapper struct {
-	mapper *Mapper
+	mapper    *Mapper
+	convs     *converters
+	syntax    KeySyntax
+	maxIndex  int
+	maxMemory int64
+	validator *Validator // validates the struct after binding, nil means no validation.
+
+	// the policies of fields to bind, see AllowFields, DenyFields and BindGroups.
+	allow  []string
+	deny   []string
+	groups []string
+}
+
+// FormOption configures a FormMapper created by NewFormMapper.
+type FormOption func(fm *FormMapper)
+
+// WithKeySyntax sets the syntax of the keys written by StructToForm.
+// FormToStruct accepts all the syntaxes, including "items[].name" which
+// binds the n-th value to the n-th element.
+func WithKeySyntax(syntax KeySyntax) FormOption {
+	return func(fm *FormMapper) {
+		fm.syntax = syntax
+	}
+}
+
+// WithMaxIndex limits the index of slice elements in form keys, so that a
+// key like "items[100000000]" can not allocate a huge slice, default is 1000.
+func WithMaxIndex(n int) FormOption {
+	return func(fm *FormMapper) {
+		fm.maxIndex = n
+	}
 }
 
 //default tagName is "form"
-func NewFormMapper(tagName string, tagFunc TagFunc) FormMapper {
+func NewFormMapper(tagName string, tagFunc TagFunc, opts ...FormOption) FormMapper {
 	if tagName == "" {
 		tagName = "form"
 	}
-	return FormMapper{
-		NewMapper(tagName, tagFunc),
+	convs := &converters{}
+	registerFileConverter(convs)
+	mapper := NewMapper(tagName, tagFunc)
+	mapper.convs = convs
+	mapper.fieldFunc = func(fi *FieldInfo) {
+		checkNormalizer(fi)
+		setTimeOptions(fi, convs)
+	}
+	fm := FormMapper{
+		mapper:    mapper,
+		convs:     convs,
+		maxIndex:  defaultMaxIndex,
+		maxMemory: defaultMaxMemory,
 	}
+	for _, opt := range opts {
+		opt(&fm)
+	}
+	return fm
+}
+
+// RegisterConverter registers the converter of type t to the FormMapper,
+// it is prior to the one registered by the package level RegisterConverter.
+func (fm FormMapper) RegisterConverter(t reflect.Type, encode EncodeFunc, decode DecodeFunc) {
+	fm.convs.register(t, encode, decode)
 }
 
 //convert map to struct
@@ -27,47 +164,402 @@ func FormToStruct(form map[string][]string, ptr interface{}) error {
 	return formMapper.FormToStruct(form, ptr)
 }
 
+// Bind binds the request to the struct that ptr points to, see FormMapper.Bind.
+func Bind(r *http.Request, ptr interface{}) error {
+	return formMapper.Bind(r, ptr)
+}
+
 //convert struct to form
 func StructToForm(obj interface{}, form map[string][]string) {
 	formMapper.StructToForm(obj, form)
 }
 
+// FormToStruct sets the fields of the struct that ptr points to by form.
+// Besides the paths of leaves like "Addr.City", the keys can be indexed to
+// bind slices, arrays and maps, for example:
+//	items[0][name]=a&items.1.name=b&items[].tags=x&meta[color]=red
+// It goes on binding after errors, and returns all of them as BindErrors.
+// The keys of fields tagged with "readonly", or not permitted by AllowFields,
+// DenyFields and BindGroups are ignored. The strings are normalized by the
+// options such as "trim" before binding, see RegisterNormalizer.
 func (fm FormMapper) FormToStruct(form map[string][]string, ptr interface{}) error {
-	typ := reflect.TypeOf(ptr).Elem()
 	val := reflect.ValueOf(ptr).Elem()
-	structMap := fm.mapper.TypeMap(typ)
+	return fm.validate(val, fm.formToStruct(form, val).err())
+}
+
+// validate validates val by the Validator of fm if binding succeeded.
+func (fm FormMapper) validate(val reflect.Value, err error) error {
+	if err != nil || fm.validator == nil {
+		return err
+	}
+	return fm.validator.validate(val, fm.mapper)
+}
 
-	if len(form) < len(structMap.Leaves) {
-		for k, strs := range form {
-			fi, ok := structMap.Leaves[k]
-			//ignore if input string is empty, the field will not rewrite
-			if !ok || len(strs) == 0 || (len(strs) == 1 && strs[0] == "") {
+func (fm FormMapper) formToStruct(form map[string][]string, val reflect.Value) (errs BindErrors) {
+	structMap := fm.mapper.TypeMap(val.Type())
+
+	for k, strs := range form {
+		//ignore if input string is empty, the field will not rewrite
+		if len(strs) == 0 || (len(strs) == 1 && strs[0] == "") {
+			continue
+		}
+		segs := splitKey(k)
+		path, fields := fm.fieldPath(val.Type(), segs)
+		if !fm.allowed(path, fields) {
+			continue
+		}
+		vals := stringValues{strs: strs}
+		if len(fields) > 0 {
+			// the options of the last field, such as "split" and "trim", prepare the strings.
+			vals.leaf = fields[len(fields)-1]
+		}
+		if !vals.distributed(segs) {
+			// prepare the strings once for all.
+			prepared, err := vals.prepare()
+			if err != nil {
+				errs = append(errs, newBindError(k, segs, strs, typeError(vals.leaf.Type, err)))
 				continue
 			}
-			if err := fi.StringsToField(strs, val); err != nil {
-				return err
-			}
-		}
-	} else {
-		for k, fi := range structMap.Leaves {
-			strs, ok := form[k]
-			//ignore if input string is empty, the field will not rewrite
-			if !ok || len(strs) == 0 || (len(strs) == 1 && strs[0] == "") {
+			if len(prepared) == 1 && prepared[0] == "" {
 				continue
 			}
-			if err := fi.StringsToField(strs, val); err != nil {
-				return err
+			vals = stringValues{strs: prepared, leaf: vals.leaf, prepared: true}
+		}
+
+		if fi, ok := structMap.Leaves[k]; ok {
+			fV := reflect.Indirect(FieldByIndexes(val, fi.Index))
+			if err := vals.setTo(fV, fm); err != nil {
+				errs = append(errs, &BindError{Key: k, Path: fi.Path, Input: strs, Type: fV.Type(), Err: err})
 			}
+			continue
+		}
+
+		if len(segs) < 2 {
+			// unknown key.
+			continue
+		}
+		if err := fm.bindPath(val, segs, vals); err != nil {
+			errs = append(errs, newBindError(k, segs, strs, err))
+		}
+	}
+
+	return errs
+}
+
+// splitKey splits the form key to segments, "items[0][name]", "items[0].name"
+// and "items.0.name" are all split to ["items", "0", "name"], "items[].name"
+// is split to ["items", "", "name"]. It returns nil for an invalid key.
+func splitKey(key string) []string {
+	var segs []string
+	for key != "" {
+		i := strings.IndexAny(key, ".[")
+		if i < 0 {
+			segs = append(segs, key)
+			break
+		}
+		if key[i] == '.' {
+			segs = append(segs, key[:i])
+			key = key[i+1:]
+			continue
 		}
+
+		if i > 0 {
+			segs = append(segs, key[:i])
+		}
+		j := strings.IndexByte(key[i:], ']')
+		if j < 0 {
+			return nil
+		}
+		segs = append(segs, key[i+1:i+j])
+		key = strings.TrimPrefix(key[i+j+1:], ".")
 	}
+	return segs
+}
+
+// bindPath sets the field of the struct v specified by segs, the segments
+// are joined to the path of the field until a slice, array or map is found.
+// Unknown paths are ignored.
+func (fm FormMapper) bindPath(v reflect.Value, segs []string, vals formValues) error {
+	sm := fm.mapper.TypeMap(v.Type())
+	path := ""
+	for i, seg := range segs {
+		if path != "" {
+			path += "."
+		}
+		path += seg
 
+		fi, ok := sm.Paths[path]
+		if !ok {
+			continue
+		}
+		if fT := Deref(fi.Type); fT.Kind() == reflect.Struct && !fm.convs.has(fT) {
+			// go on joining the path of the child struct.
+			continue
+		}
+		return fm.bindValue(FieldByIndexes(v, fi.Index), segs[i+1:], vals)
+	}
 	return nil
 }
 
+// bindValue sets v by the rest segments of the key.
+func (fm FormMapper) bindValue(v reflect.Value, segs []string, vals formValues) error {
+	if len(segs) == 0 {
+		return typeError(v.Type(), vals.setTo(v, fm))
+	}
+	v = AllocIndirect(v)
+	if fm.convs.has(v.Type()) {
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		return fm.bindPath(v, segs, vals)
+	case reflect.Slice, reflect.Array:
+		if segs[0] == "" {
+			// "items[].name", the n-th value is bound to the n-th element.
+			for i := 0; i < vals.len(); i++ {
+				elem, err := fm.index(v, i)
+				if err != nil {
+					return typeError(v.Type(), err)
+				}
+				if err = fm.bindValue(elem, segs[1:], vals.slice(i, i+1)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		i, err := strconv.Atoi(segs[0])
+		if err != nil || i < 0 {
+			return typeError(v.Type(), errors.New("invalid index "+segs[0]))
+		}
+		elem, err := fm.index(v, i)
+		if err != nil {
+			return typeError(v.Type(), err)
+		}
+		return fm.bindValue(elem, segs[1:], vals)
+	case reflect.Map:
+		fT := v.Type()
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(fT))
+		}
+		key := reflect.New(fT.Key()).Elem()
+		if err := strToValue(segs[0], key, fm.convs); err != nil {
+			return typeError(key.Type(), err)
+		}
+		// the elements of map are not addressable, set a copy of it.
+		elem := reflect.New(fT.Elem()).Elem()
+		if old := v.MapIndex(key); old.IsValid() {
+			elem.Set(old)
+		}
+		if err := fm.bindValue(elem, segs[1:], vals); err != nil {
+			return err
+		}
+		v.SetMapIndex(key, elem)
+		return nil
+	default:
+		return nil
+	}
+}
+
+// formValues are the values of a form key, such as strings or files.
+type formValues interface {
+	len() int
+	slice(i, j int) formValues
+	// setTo sets the values to v, v may be a nil pointer.
+	setTo(v reflect.Value, fm FormMapper) error
+}
+
+// stringValues are the strings of a form key, they are split and normalized
+// by the options of the leaf field before setting, leaf may be nil. The time
+// options of the leaf are used to convert time.Time.
+type stringValues struct {
+	strs []string
+	leaf *FieldInfo
+	// prepared is true if strs have been prepared.
+	prepared bool
+}
+
+func (s stringValues) len() int {
+	return len(s.strs)
+}
+
+func (s stringValues) slice(i, j int) formValues {
+	return stringValues{s.strs[i:j], s.leaf, s.prepared}
+}
+
+func (s stringValues) setTo(v reflect.Value, fm FormMapper) error {
+	convs := fieldConverters(s.leaf, fm.convs)
+	if v.Kind() == reflect.Ptr && !convs.has(v.Type()) {
+		v = AllocIndirect(v)
+	}
+	strs, err := s.prepare()
+	if err != nil {
+		return err
+	}
+	return setStrings(strs, v, convs)
+}
+
+// prepare splits the strings by the "split" option of the leaf, and then
+// normalizes them.
+func (s stringValues) prepare() ([]string, error) {
+	if s.leaf == nil || s.prepared {
+		return s.strs, nil
+	}
+	strs := s.strs
+	if sep, ok := splitSep(s.leaf); ok {
+		strs = nil
+		for _, str := range s.strs {
+			items, err := splitList(str, sep)
+			if err != nil {
+				return nil, err
+			}
+			strs = append(strs, items...)
+		}
+	}
+	return normalize(s.leaf, strs), nil
+}
+
+// distributed returns whether the strings are distributed to the elements
+// by the key like "items[].tags", so that every string is prepared alone.
+func (s stringValues) distributed(segs []string) bool {
+	if s.leaf == nil {
+		return false
+	}
+	for _, seg := range segs {
+		if seg == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// splitSep returns the separator of the "split" option of fi, "split=,"
+// is parsed to an empty value because the tag is split by ',' as well.
+func splitSep(fi *FieldInfo) (string, bool) {
+	sep, ok := fi.Options[Split]
+	if ok && sep == "" {
+		sep = ","
+	}
+	return sep, ok
+}
+
+// splitList splits s by sep, an item is quoted by '"' if it contains sep,
+// '"' or is empty, and '"' in the quoted item is escaped as `""`, such as:
+//	a,"b,c","say ""hi""",""
+func splitList(s, sep string) ([]string, error) {
+	var items []string
+	for {
+		if !strings.HasPrefix(s, `"`) {
+			i := strings.Index(s, sep)
+			if i < 0 {
+				return append(items, s), nil
+			}
+			items = append(items, s[:i])
+			s = s[i+len(sep):]
+			continue
+		}
+
+		// the quoted item.
+		var b strings.Builder
+		s = s[1:]
+		for {
+			i := strings.IndexByte(s, '"')
+			if i < 0 {
+				return nil, errors.New("missing closing quote in list")
+			}
+			b.WriteString(s[:i])
+			s = s[i+1:]
+			if !strings.HasPrefix(s, `"`) {
+				break
+			}
+			b.WriteByte('"')
+			s = s[1:]
+		}
+		items = append(items, b.String())
+		if s == "" {
+			return items, nil
+		}
+		if !strings.HasPrefix(s, sep) {
+			return nil, errors.New("unexpected characters after quoted item in list")
+		}
+		s = s[len(sep):]
+	}
+}
+
+// joinList joins items by sep, the items are quoted as splitList expects.
+func joinList(items []string, sep string) string {
+	quoted := make([]string, len(items))
+	for i, item := range items {
+		if item == "" || strings.Contains(item, sep) || strings.Contains(item, `"`) {
+			item = `"` + strings.ReplaceAll(item, `"`, `""`) + `"`
+		}
+		quoted[i] = item
+	}
+	return strings.Join(quoted, sep)
+}
+
+// index returns the i-th element of the slice or array v, the slice grows if
+// i is out of range.
+func (fm FormMapper) index(v reflect.Value, i int) (reflect.Value, error) {
+	if i >= fm.maxIndex {
+		return reflect.Value{}, fmt.Errorf("index %d exceeds the max index %d", i, fm.maxIndex)
+	}
+	if v.Kind() == reflect.Array {
+		if i >= v.Len() {
+			return reflect.Value{}, fmt.Errorf("index %d out of range of %v", i, v.Type())
+		}
+		return v.Index(i), nil
+	}
+	if n := i + 1 - v.Len(); n > 0 {
+		v.Set(reflect.AppendSlice(v, reflect.MakeSlice(v.Type(), n, n)))
+	}
+	return v.Index(i), nil
+}
+
+// setStrings sets strs to v, v is a slice, an array or has only one string.
+func setStrings(strs []string, v reflect.Value, cs *converters) error {
+	if k := v.Kind(); (k == reflect.Slice || k == reflect.Array) && !cs.has(v.Type()) {
+		if k == reflect.Slice {
+			v.Set(reflect.MakeSlice(v.Type(), len(strs), len(strs)))
+		} else if len(strs) > v.Len() {
+			return fmt.Errorf("expected at most %d values for %v, got %d", v.Len(), v.Type(), len(strs))
+		}
+		for i := range strs {
+			if err := strToValue(strs[i], v.Index(i), cs); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if v.Kind() == reflect.Interface && v.NumMethod() == 0 && !cs.has(v.Type()) {
+		// interface{}, such as the elements of map[string]interface{}.
+		if len(strs) == 1 {
+			v.Set(reflect.ValueOf(strs[0]))
+		} else {
+			v.Set(reflect.ValueOf(append([]string(nil), strs...)))
+		}
+		return nil
+	}
+	if len(strs) > 1 {
+		return fmt.Errorf("expected one value for %v, got %d", v.Type(), len(strs))
+	}
+	if v.Kind() == reflect.Map && !cs.has(v.Type()) {
+		return fmt.Errorf("expected keys like [key] for %v", v.Type())
+	}
+	return strToValue(strs[0], v, cs)
+}
+
 // Convert struct to form.
+// The slices of scalars are written as repeated values of the key, the other
+// slices, arrays and maps are written with indexed keys by the KeySyntax.
 func (fm FormMapper) StructToForm(obj interface{}, form map[string][]string) {
-	typ, val := Indirect(obj)
-	structMap := fm.mapper.TypeMap(typ)
+	_, val := Indirect(obj)
+	fm.structToForm("", val, form)
+}
+
+// structToForm writes the leaves of the struct val to form, prefix is the key of val.
+func (fm FormMapper) structToForm(prefix string, val reflect.Value, form map[string][]string) {
+	structMap := fm.mapper.TypeMap(val.Type())
 
 	for k, fi := range structMap.Leaves {
 		fV := FieldByIndexesReadOnly(val, fi.Index)
@@ -76,32 +568,115 @@ func (fm FormMapper) StructToForm(obj interface{}, form map[string][]string) {
 		if !fV.IsValid() {
 			continue
 		}
+		// the time options of fi are used to convert time.Time.
+		fm := fm
+		fm.convs = fieldConverters(fi, fm.convs)
 
-		switch fV.Kind() {
-		case reflect.Slice:
-			//omitempty??
-			numElems := fV.Len()
-			if numElems > 0 {
-				slice := make([]string, numElems)
-				var err error
-				for i := 0; i < numElems; i++ {
-					if slice[i], err = ValueToStr(fV.Index(i)); err != nil {
-						panic(err)
-					}
-				}
-				form[k] = slice
+		//omitempty
+		if _, ok := fi.Options[OmitEmpty]; ok && (fV.Kind() != reflect.Slice || fm.convs.has(fV.Type())) {
+			if reflect.DeepEqual(fV.Interface(), fi.Zero.Interface()) {
+				continue
 			}
-		default:
-			//omitempty
-			_, ok := fi.Options[OmitEmpty]
-			if !ok || !reflect.DeepEqual(fV.Interface(), fi.Zero.Interface()) {
-				str, err := ValueToStr(fV)
-				if err != nil {
-					panic(err)
-				}
-				form[k] = []string{str}
+		}
+		if sep, ok := splitSep(fi); ok && (fV.Kind() == reflect.Slice || fV.Kind() == reflect.Array) && fm.isScalar(fV.Type().Elem()) {
+			// the elements are joined by the separator of "split".
+			if fV.Len() == 0 {
+				continue
+			}
+			items := make([]string, fV.Len())
+			for i := range items {
+				items[i] = mustValueToStr(fV.Index(i), fm.convs)
 			}
+			form[fm.joinKey(prefix, k)] = []string{joinList(items, sep)}
+			continue
 		}
+		fm.valueToForm(fm.joinKey(prefix, k), fV, form)
+	}
+}
+
+// valueToForm writes v to form with key, v is not a pointer.
+func (fm FormMapper) valueToForm(key string, v reflect.Value, form map[string][]string) {
+	if v.Kind() == reflect.Interface {
+		// the dynamic value of interface{}, such as the elements of map[string]interface{}.
+		if v = reflect.Indirect(v.Elem()); !v.IsValid() {
+			return
+		}
+	}
+	fT := v.Type()
+	if fm.convs.has(fT) {
+		form[key] = []string{mustValueToStr(v, fm.convs)}
+		return
+	}
+
+	switch fT.Kind() {
+	case reflect.Struct:
+		fm.structToForm(key, v, form)
+	case reflect.Slice, reflect.Array:
+		numElems := v.Len()
+		if numElems == 0 {
+			return
+		}
+		if fm.isScalar(fT.Elem()) {
+			slice := make([]string, numElems)
+			for i := 0; i < numElems; i++ {
+				slice[i] = mustValueToStr(v.Index(i), fm.convs)
+			}
+			form[key] = slice
+			return
+		}
+		for i := 0; i < numElems; i++ {
+			if elem := reflect.Indirect(v.Index(i)); elem.IsValid() {
+				fm.valueToForm(fm.joinIndex(key, strconv.Itoa(i)), elem, form)
+			}
+		}
+	case reflect.Map:
+		for _, k := range v.MapKeys() {
+			if elem := reflect.Indirect(v.MapIndex(k)); elem.IsValid() {
+				fm.valueToForm(fm.joinIndex(key, mustValueToStr(k, fm.convs)), elem, form)
+			}
+		}
+	default:
+		form[key] = []string{mustValueToStr(v, fm.convs)}
+	}
+}
+
+// isScalar returns whether t can be converted to a string.
+func (fm FormMapper) isScalar(t reflect.Type) bool {
+	switch Deref(t).Kind() {
+	case reflect.Struct:
+		return fm.convs.has(t)
+	case reflect.Slice, reflect.Array, reflect.Map, reflect.Interface:
+		return false
+	}
+	return true
+}
+
+// joinKey appends the path or index to prefix by the KeySyntax of fm.
+func (fm FormMapper) joinKey(prefix, path string) string {
+	switch {
+	case prefix == "":
+		return path
+	case fm.syntax == DotKeys:
+		return prefix + "." + path
+	default:
+		return prefix + "[" + strings.Replace(path, ".", "][", -1) + "]"
+	}
+}
+
+// joinIndex appends the index of slice or the key of map to prefix by the
+// KeySyntax of fm. Note that the keys of map containing "." or "]" can not be
+// decoded correctly with DotKeys.
+func (fm FormMapper) joinIndex(prefix, index string) string {
+	if fm.syntax == DotKeys {
+		return prefix + "." + index
+	}
+	return prefix + "[" + index + "]"
+}
+
+func mustValueToStr(v reflect.Value, cs *converters) string {
+	str, err := valueToStr(v, cs)
+	if err != nil {
+		panic(err)
 	}
-	return
+	return str
 }
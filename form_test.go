@@ -4,6 +4,9 @@ import (
 	"bytes"
 	"encoding/gob"
 	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"reflect"
 	"strings"
@@ -212,6 +215,112 @@ func TestOmitempty(t *testing.T) {
 	assert.Equal(t, len(form), 0)
 }
 
+type LineItem struct {
+	Name string `form:"name"`
+	Qty  int    `form:"qty"`
+	Tags []string
+}
+
+type Invoice struct {
+	ID    int                  `form:"id"`
+	Items []LineItem           `form:"items"`
+	PItem []*LineItem          `form:"pitems"`
+	Meta  map[string]string    `form:"meta"`
+	Attrs map[string]*LineItem `form:"attrs"`
+	Dims  [2]int               `form:"dims"`
+}
+
+func TestIndexedForm(t *testing.T) {
+	expect := Invoice{
+		ID: 1,
+		Items: []LineItem{
+			{Name: "a", Qty: 1, Tags: []string{"x", "y"}},
+			{Name: "b", Qty: 2},
+			{Name: "c"},
+		},
+		PItem: []*LineItem{{Name: "p"}},
+		Meta:  map[string]string{"color": "red"},
+		Attrs: map[string]*LineItem{"k": {Qty: 3}},
+		Dims:  [2]int{4, 5},
+	}
+
+	form := map[string][]string{
+		"id":               {"1"},
+		"items[0][name]":   {"a"},
+		"items[0][qty]":    {"1"},
+		"items.0.Tags":     {"x", "y"},
+		"items[1].name":    {"b"},
+		"items.1.qty":      {"2"},
+		"items[2][name]":   {"c"},
+		"pitems[].name":    {"p"},
+		"meta[color]":      {"red"},
+		"attrs[k][qty]":    {"3"},
+		"dims[]":           {"4", "5"},
+		"unknown[0][name]": {"x"},
+	}
+	var o Invoice
+	assert.Nil(t, FormToStruct(form, &o))
+	assert.Equal(t, expect, o)
+
+	// encode and decode with both syntaxes.
+	for syntax, key := range map[KeySyntax]string{BracketKeys: "items[0][name]", DotKeys: "items.0.name"} {
+		fm := NewFormMapper("", nil, WithKeySyntax(syntax))
+		form := make(map[string][]string)
+		fm.StructToForm(expect, form)
+		assert.Equal(t, []string{"a"}, form[key])
+		assert.Equal(t, []string{"4", "5"}, form["dims"])
+
+		var o Invoice
+		assert.Nil(t, fm.FormToStruct(form, &o))
+		assert.Equal(t, expect, o)
+	}
+
+	o = Invoice{}
+	assert.Nil(t, FormToStruct(map[string][]string{"meta[a.b]": {"c"}, "meta.d": {"e"}}, &o))
+	assert.Equal(t, map[string]string{"a.b": "c", "d": "e"}, o.Meta)
+
+	fm := NewFormMapper("", nil, WithMaxIndex(10))
+	err := fm.FormToStruct(map[string][]string{"items[10][name]": {"a"}}, &o)
+	assert.EqualError(t, err, "reflectx: can not bind items[10][name] to []reflectx.LineItem: index 10 exceeds the max index 10")
+	err = fm.FormToStruct(map[string][]string{"dims[2]": {"1"}}, &o)
+	assert.EqualError(t, err, "reflectx: can not bind dims[2] to [2]int: index 2 out of range of [2]int")
+}
+
+func TestBindErrors(t *testing.T) {
+	form := map[string][]string{
+		"id":            {"x"},
+		"items[1][qty]": {"y"},
+		"items[0][qty]": {"1"},
+		"dims[5]":       {"2"},
+	}
+	var o Invoice
+	err := FormToStruct(form, &o)
+	errs, ok := err.(BindErrors)
+	assert.True(t, ok)
+	assert.Len(t, errs, 3)
+
+	// the valid keys are bound as well.
+	assert.Equal(t, 1, o.Items[0].Qty)
+
+	// sorted by keys.
+	assert.Equal(t, "dims[5]", errs[0].Key)
+	assert.Equal(t, "dims.5", errs[0].Path)
+	assert.Equal(t, []string{"2"}, errs[0].Input)
+	assert.Equal(t, reflect.TypeOf([2]int{}), errs[0].Type)
+
+	assert.Equal(t, "id", errs[1].Key)
+	assert.Equal(t, "id", errs[1].Path)
+	assert.Equal(t, reflect.TypeOf(0), errs[1].Type)
+	assert.True(t, errors.Is(errs[1], errs[1].Err))
+
+	assert.Equal(t, "items[1][qty]", errs[2].Key)
+	assert.Equal(t, "items.1.qty", errs[2].Path)
+	assert.Equal(t, []string{"y"}, errs[2].Input)
+	assert.Equal(t, reflect.TypeOf(0), errs[2].Type)
+
+	assert.Equal(t, errs[0].Error()+"; "+errs[1].Error()+"; "+errs[2].Error(), err.Error())
+}
+
 func Benchmark_FormToStruct(b *testing.B) {
 
 	b.ReportAllocs()
@@ -309,6 +418,126 @@ func (m *Form) Decode(query string) error {
 	return nil
 }
 
+type Filter struct {
+	Tags   []string  `form:"tags,split=,"`
+	IDs    []int     `form:"ids,split=|"`
+	Names  [2]string `form:"names,split=;,trim"`
+	Groups []Group   `form:"groups"`
+	Plain  []string  `form:"plain"`
+}
+
+type Group struct {
+	Users []string `form:"users,split=,"`
+}
+
+func TestSplitForm(t *testing.T) {
+	form := map[string][]string{
+		"tags":             {`a,"b,c","say ""hi""",""`, "d"},
+		"ids":              {"1|2|3"},
+		"names":            {" x ; y "},
+		"groups[0][users]": {"u1,u2"},
+		"plain":            {"a,b"},
+	}
+	var f Filter
+	assert.Nil(t, FormToStruct(form, &f))
+	assert.Equal(t, []string{"a", "b,c", `say "hi"`, "", "d"}, f.Tags)
+	assert.Equal(t, []int{1, 2, 3}, f.IDs)
+	assert.Equal(t, [2]string{"x", "y"}, f.Names)
+	assert.Equal(t, []string{"a,b"}, f.Plain)
+
+	f = Filter{}
+	assert.Nil(t, FormToStruct(map[string][]string{"groups[].users": {"v1,v2", "w1"}}, &f))
+	assert.Equal(t, []Group{{Users: []string{"v1", "v2"}}, {Users: []string{"w1"}}}, f.Groups)
+
+	// StructToForm joins the elements with quoting.
+	f = Filter{
+		Tags:   []string{"a", "b,c", `say "hi"`, ""},
+		IDs:    []int{1, 2},
+		Groups: []Group{{Users: []string{"u1", "u2"}}},
+	}
+	out := map[string][]string{}
+	StructToForm(f, out)
+	assert.Equal(t, []string{`a,"b,c","say ""hi""",""`}, out["tags"])
+	assert.Equal(t, []string{"1|2"}, out["ids"])
+	assert.Equal(t, []string{"u1,u2"}, out["groups[0][users]"])
+	var back Filter
+	assert.Nil(t, FormToStruct(out, &back))
+	assert.Equal(t, f.Tags, back.Tags)
+	assert.Equal(t, f.IDs, back.IDs)
+	assert.Equal(t, f.Groups, back.Groups)
+
+	err := FormToStruct(map[string][]string{"tags": {`a,"b`}}, &f)
+	assert.EqualError(t, err, "reflectx: can not bind tags to []string: missing closing quote in list")
+	err = FormToStruct(map[string][]string{"ids": {"1|x"}}, &f)
+	assert.EqualError(t, err, `reflectx: can not bind ids to []int: strconv.ParseInt: parsing "x": invalid syntax`)
+
+	// a string of json body is split as well, but not the elements of arrays.
+	body := `{"tags": "a,b", "groups": [{"users": ["x,y"]}]}`
+	r := httptest.NewRequest(http.MethodPost, "/filter", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	f = Filter{}
+	assert.Nil(t, NewBinder("", nil).Bind(r, &f))
+	assert.Equal(t, []string{"a", "b"}, f.Tags)
+	assert.Equal(t, []Group{{Users: []string{"x,y"}}}, f.Groups)
+}
+
+type Product struct {
+	Attr   map[string]string         `form:"attr"`
+	Multi  map[string][]string       `form:"multi"`
+	Scores map[int]float64           `form:"scores"`
+	Nested map[string]map[string]int `form:"nested"`
+	Ptr    map[string]*int           `form:"ptr"`
+	Extra  map[string]interface{}    `form:"extra"`
+}
+
+func TestMapFields(t *testing.T) {
+	form := map[string][]string{
+		"attr.color":   {"red"},
+		"attr[size]":   {"xl"},
+		"multi[tags]":  {"a", "b"},
+		"scores[1]":    {"1.5"},
+		"scores.2":     {"2"},
+		"nested[a][b]": {"3"},
+		"ptr[x]":       {"4"},
+		"extra[q]":     {"z"},
+		"extra[r]":     {"x", "y"},
+	}
+	four := 4
+	expect := Product{
+		Attr:   map[string]string{"color": "red", "size": "xl"},
+		Multi:  map[string][]string{"tags": {"a", "b"}},
+		Scores: map[int]float64{1: 1.5, 2: 2},
+		Nested: map[string]map[string]int{"a": {"b": 3}},
+		Ptr:    map[string]*int{"x": &four},
+		Extra:  map[string]interface{}{"q": "z", "r": []string{"x", "y"}},
+	}
+	var p Product
+	assert.Nil(t, FormToStruct(form, &p))
+	assert.Equal(t, expect, p)
+
+	for _, syntax := range []KeySyntax{BracketKeys, DotKeys} {
+		fm := NewFormMapper("", nil, WithKeySyntax(syntax))
+		out := map[string][]string{}
+		fm.StructToForm(expect, out)
+		if syntax == BracketKeys {
+			assert.Equal(t, []string{"red"}, out["attr[color]"])
+			assert.Equal(t, []string{"a", "b"}, out["multi[tags]"])
+			assert.Equal(t, []string{"3"}, out["nested[a][b]"])
+			assert.Equal(t, []string{"x", "y"}, out["extra[r]"])
+		} else {
+			assert.Equal(t, []string{"red"}, out["attr.color"])
+			assert.Equal(t, []string{"1.5"}, out["scores.1"])
+		}
+		p = Product{}
+		assert.Nil(t, fm.FormToStruct(out, &p))
+		assert.Equal(t, expect, p)
+	}
+
+	// a map field needs keys.
+	err := FormToStruct(map[string][]string{"attr": {"red"}}, &p)
+	assert.EqualError(t, err, "reflectx: can not bind attr to map[string]string: expected keys like [key] for map[string]string")
+}
+
 func TestMapStruct(t *testing.T) {
 	dest := make(Form)
 	dest["Foo"] = []string{"foo"}
@@ -350,7 +579,7 @@ func TestToStruct(t *testing.T) {
 		t.Error("expect error here")
 		return
 	}
-	assert.Equal(t, err.Error(), "reflectx: can not convert [1 2 3 4 5] to reflectx.ErrorStruct.Bar")
+	assert.Equal(t, err.Error(), "reflectx: can not bind Bar to map[int]string: expected one value for map[int]string, got 5")
 }
 
 type AllStruct struct {
@@ -2,4 +2,7 @@ module github.com/zltgo/reflectx
 
 go 1.16
 
-require gopkg.in/mgo.v2 v2.0.0-20190816093944-a6b53ec6cb22 // indirect
+require (
+	golang.org/x/text v0.14.0
+	gopkg.in/mgo.v2 v2.0.0-20190816093944-a6b53ec6cb22
+)
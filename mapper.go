@@ -17,10 +17,20 @@ var (
 	IgnoreThisField = "-"
 	//the field is skipped if empty.
 	OmitEmpty = "omitempty"
+	// the field is skipped if it is the zero value or its IsZero method returns true.
+	OmitZero = "omitzero"
 	// Field is not processed further by this package.
 	OmitNested = "omitnested"
 	// The FieldStruct's fields will be flattened into the parent level.
 	Flatten = "flatten"
+	// The map field collects the unknown keys decoded by Reflector.
+	Remain = "remain"
+	// The field is never bound by FormMapper.
+	ReadOnly = "readonly"
+	// The field is bound by FormMapper only with the groups, such as "bindonly=create|update".
+	BindOnly = "bindonly"
+	// The slice field is bound from and written to a single form value joined by the separator, such as "split=,".
+	Split = "split"
 	// No tag, use the original name of field
 	StdMapper = NewMapper("", nil)
 )
@@ -40,17 +50,20 @@ type FieldInfo struct {
 	Embedded bool
 	Children []*FieldInfo
 	Parent   *FieldInfo
+	// the converters with the time options of the field, nil if there is no time option.
+	convs *converters
 }
 
 func (fi *FieldInfo) StringsToField(strs []string, v reflect.Value) error {
+	return fi.stringsToField(strs, v, nil)
+}
+
+func (fi *FieldInfo) stringsToField(strs []string, v reflect.Value, cs *converters) error {
 	fV := reflect.Indirect(FieldByIndexes(v, fi.Index))
 
-	if fV.Kind() == reflect.Slice {
-		fV.Set(reflect.MakeSlice(fV.Type(), len(strs), len(strs)))
-		for i := range strs {
-			if err := StrToValue(strs[i], fV.Index(i)); err != nil {
-				return fmt.Errorf("reflectx: can not convert %v to %v: %v", strs, v.Type().String()+"."+fi.Path, err)
-			}
+	if k := fV.Kind(); (k == reflect.Slice || k == reflect.Array) && !cs.has(fV.Type()) {
+		if err := setStrings(strs, fV, cs); err != nil {
+			return fmt.Errorf("reflectx: can not convert %v to %v: %v", strs, v.Type().String()+"."+fi.Path, err)
 		}
 		return nil
 	}
@@ -58,7 +71,7 @@ func (fi *FieldInfo) StringsToField(strs []string, v reflect.Value) error {
 	if len(strs) > 1 {
 		return fmt.Errorf("reflectx: can not convert %v to %v", strs, v.Type().String()+"."+fi.Path)
 	}
-	if err := StrToValue(strs[0], fV); err != nil {
+	if err := strToValue(strs[0], fV, cs); err != nil {
 		return err
 	}
 
@@ -70,7 +83,7 @@ type StructMap struct {
 	Tree   *FieldInfo
 	Fields []*FieldInfo          //all the fields of the tree.
 	Paths  map[string]*FieldInfo // equal to Fields.
-	Leaves map[string]*FieldInfo // all the leaves of the tree, not including struct type.
+	Leaves map[string]*FieldInfo // all the leaves of the tree, not including struct type without converter.
 }
 
 // GetByPath returns a *FieldInfo for a given string path.
@@ -104,6 +117,10 @@ type Mapper struct {
 	tagName string
 	tagFunc TagFunc
 	cache   sync.Map //map[reflect.Type]StructMap
+	names   sync.Map //map[string]StructMap, indexed by reflect.Type.String()
+	convs   *converters // the struct types with converter are leaves.
+	// fieldFunc checks the options and prepares fi when the field is mapped, it may be nil.
+	fieldFunc func(fi *FieldInfo)
 }
 
 // the input fieldName is equal to reflect.Field.Name() of the struct.
@@ -162,23 +179,21 @@ func (m *Mapper) TypeMap(t reflect.Type) StructMap {
 		return mapping.(StructMap)
 	}
 
-	mapping := getMapping(t, m.tagName, m.tagFunc)
+	mapping := getMapping(t, m.tagName, m.tagFunc, m.convs, m.fieldFunc)
 	m.cache.Store(t, mapping)
+	// keep the first type registered with the name.
+	m.names.LoadOrStore(t.String(), mapping)
 	return mapping
 }
 
-// NameMap returns StructMap by struct name.
+// NameMap returns StructMap by struct name, the name is equal to reflect.Type.String().
+// Only the types mapped by TypeMap before can be found.
 func (m *Mapper) NameMap(name string) (sm StructMap, exist bool) {
-	m.cache.Range(func(key, value interface{}) bool {
-		if key.(reflect.Type).String() == name {
-			sm = value.(StructMap)
-			exist = true
-			return false
-		}
-		return true
-	})
-
-	return
+	mapping, ok := m.names.Load(name)
+	if !ok {
+		return sm, false
+	}
+	return mapping.(StructMap), true
 }
 
 // FieldMap returns the mapper's mapping of field names to reflect values.
@@ -353,7 +368,7 @@ func parseOptions(parts []string) map[string]string {
 
 // getMapping returns a mapping for the t type, using the tagName, mapFunc and
 // tagMapFunc to determine the canonical names of fields.
-func getMapping(t reflect.Type, tagName string, tagFunc func(string, string) (string, []string)) StructMap {
+func getMapping(t reflect.Type, tagName string, tagFunc func(string, string) (string, []string), convs *converters, fieldFunc func(*FieldInfo)) StructMap {
 	root := &FieldInfo{
 		IsPtr: t.Kind() == reflect.Ptr,
 		Type:  t,
@@ -428,10 +443,13 @@ QueueLoop:
 			} else {
 				fi.Path = tq.fi.Path + "." + fi.Name
 			}
+			if fieldFunc != nil {
+				fieldFunc(fi)
+			}
 
 			owner := fi
 			// go on mapping fields of child struct
-			if Deref(fi.Type).Kind() == reflect.Struct {
+			if !convs.isLeaf(fi.Type) {
 				_, ok := fi.Options[Flatten]
 				// case one:
 				// the child struct has "flatten" tag.
@@ -487,7 +505,7 @@ QueueLoop:
 			panic(fmt.Errorf("duplicated path: %v, indexs are %v and %v", t.String()+"."+fi.Name, v.Index, fi.Index))
 		}
 		flds.Paths[fi.Path] = fi
-		if Deref(fi.Type).Kind() != reflect.Struct {
+		if convs.isLeaf(fi.Type) {
 			flds.Leaves[fi.Path] = fi
 		}
 	}
@@ -889,6 +889,35 @@ type E4 struct {
 	D int
 }
 
+func TestNameMap(t *testing.T) {
+	type Foo struct {
+		A int
+	}
+	type Bar struct {
+		B int
+	}
+
+	m := NewMapper("", nil)
+	if _, ok := m.NameMap("reflectx.Foo"); ok {
+		t.Error("expected not found before mapping")
+	}
+
+	m.TypeMap(reflect.TypeOf(Foo{}))
+	m.TypeMap(reflect.TypeOf(&Bar{}))
+
+	sm, ok := m.NameMap("reflectx.Foo")
+	if !ok || sm.Tree.Type != reflect.TypeOf(Foo{}) {
+		t.Errorf("expected reflectx.Foo, got %v", sm.Tree)
+	}
+	sm, ok = m.NameMap("*reflectx.Bar")
+	if !ok || sm.Tree.Type != reflect.TypeOf(&Bar{}) {
+		t.Errorf("expected *reflectx.Bar, got %v", sm.Tree)
+	}
+	if _, ok = m.NameMap("reflectx.Bar"); ok {
+		t.Error("expected not found with the name of elem type")
+	}
+}
+
 func BenchmarkFieldNameL1(b *testing.B) {
 	e4 := E4{D: 1}
 	for i := 0; i < b.N; i++ {
@@ -0,0 +1,211 @@
+package reflectx
+
+import (
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"sync"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// ReflectMarshaler is implemented by types that control their representation
+// encoded by Reflector. If the result is a map[string]interface{} and the type
+// is a struct, the name of the struct is marked as usual.
+type ReflectMarshaler interface {
+	MarshalReflect() (interface{}, error)
+}
+
+// ReflectUnmarshaler is implemented by types that decode the representation
+// returned by MarshalReflect, the name of struct is removed from v.
+// Note that numbers of json are json.Number.
+type ReflectUnmarshaler interface {
+	UnmarshalReflect(v interface{}) error
+}
+
+// the marshaler interfaces implemented by a type or the pointer of it.
+const (
+	implReflectMarshaler = 1 << iota
+	implJSONMarshaler
+	implBSONGetter
+	implTextMarshaler
+	implReflectUnmarshaler
+	implJSONUnmarshaler
+	implBSONSetter
+	implTextUnmarshaler
+)
+
+var (
+	reflectMarshalerType   = reflect.TypeOf((*ReflectMarshaler)(nil)).Elem()
+	jsonMarshalerType      = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	bsonGetterType         = reflect.TypeOf((*bson.Getter)(nil)).Elem()
+	textMarshalerType      = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	reflectUnmarshalerType = reflect.TypeOf((*ReflectUnmarshaler)(nil)).Elem()
+	jsonUnmarshalerType    = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	bsonSetterType         = reflect.TypeOf((*bson.Setter)(nil)).Elem()
+	textUnmarshalerType    = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	timeType               = reflect.TypeOf(time.Time{})
+	bsonPkgPath            = reflect.TypeOf(bson.M{}).PkgPath()
+
+	implCache sync.Map //map[reflect.Type]int
+)
+
+// implementsOf returns the marshaler interfaces implemented by t or the pointer of t.
+func implementsOf(t reflect.Type) int {
+	if impl, ok := implCache.Load(t); ok {
+		return impl.(int)
+	}
+
+	impl := 0
+	pt := reflect.PtrTo(t)
+	for i, it := range []reflect.Type{
+		reflectMarshalerType,
+		jsonMarshalerType,
+		bsonGetterType,
+		textMarshalerType,
+		reflectUnmarshalerType,
+		jsonUnmarshalerType,
+		bsonSetterType,
+		textUnmarshalerType,
+	} {
+		if pt.Implements(it) {
+			impl |= 1 << uint(i)
+		}
+	}
+	implCache.Store(t, impl)
+	return impl
+}
+
+// isBSONNative returns whether t is supported by bson without marshaler,
+// such as time.Time and bson.ObjectId.
+func isBSONNative(t reflect.Type) bool {
+	if t == timeType {
+		return true
+	}
+	// bson.M and bson.D may contain structs.
+	return t.PkgPath() == bsonPkgPath && t.Kind() != reflect.Map && t.Kind() != reflect.Slice
+}
+
+// addrOf returns a pointer to v, v is copied if it is not addressable.
+func addrOf(v reflect.Value) reflect.Value {
+	if v.CanAddr() {
+		return v.Addr()
+	}
+	ptr := reflect.New(v.Type())
+	ptr.Elem().Set(v)
+	return ptr
+}
+
+// marshalValue encodes fV by the marshaler it implements, ok is false if there is no marshaler.
+// For json format, json.Marshaler is prior to encoding.TextMarshaler.
+// For bson format, bson.Getter is prior to the types supported by bson and encoding.TextMarshaler.
+func (e *encodeState) marshalValue(fT reflect.Type, fV reflect.Value, static bool) (rv interface{}, ok bool) {
+	impl := implementsOf(fT)
+	bsonNative := e.format == "bson" && isBSONNative(fT)
+	if impl&(implReflectMarshaler|implJSONMarshaler|implBSONGetter|implTextMarshaler) == 0 && !bsonNative {
+		return nil, false
+	}
+
+	var err error
+	switch {
+	case impl&implReflectMarshaler != 0:
+		rv, err = addrOf(fV).Interface().(ReflectMarshaler).MarshalReflect()
+		if mp, ok := rv.(map[string]interface{}); ok && fT.Kind() == reflect.Struct && !(static && e.omitStaticName) {
+			// do not change the map returned by MarshalReflect.
+			fields := make(map[string]interface{}, len(mp)+1)
+			for k, v := range mp {
+				fields[k] = v
+			}
+			rv = e.markName(fT.String(), fields)
+		}
+	case e.format == "bson" && impl&implBSONGetter != 0:
+		rv, err = addrOf(fV).Interface().(bson.Getter).GetBSON()
+	case bsonNative:
+		rv = fV.Interface()
+	case e.format != "bson" && impl&implJSONMarshaler != 0:
+		var b []byte
+		b, err = addrOf(fV).Interface().(json.Marshaler).MarshalJSON()
+		rv = json.RawMessage(b)
+	case impl&implTextMarshaler != 0:
+		var b []byte
+		b, err = addrOf(fV).Interface().(encoding.TextMarshaler).MarshalText()
+		rv = string(b)
+	default:
+		return nil, false
+	}
+
+	if err != nil {
+		e.setErr(err)
+		return nil, true
+	}
+	return rv, true
+}
+
+// unmarshalValue decodes val to field by the unmarshaler field implements,
+// ok is false if there is no unmarshaler.
+func (d *decodeState) unmarshalValue(val interface{}, field reflect.Value) (ok bool, err error) {
+	impl := implementsOf(field.Type())
+	if impl&(implReflectUnmarshaler|implJSONUnmarshaler|implBSONSetter|implTextUnmarshaler) == 0 {
+		return false, nil
+	}
+
+	ptr := field.Addr().Interface()
+	switch {
+	case impl&implReflectUnmarshaler != 0:
+		if mp, ok := val.(map[string]interface{}); ok {
+			val = d.stripName(mp)
+		}
+		return true, ptr.(ReflectUnmarshaler).UnmarshalReflect(val)
+	case d.format == "bson" && impl&implBSONSetter != 0:
+		// wrap val to a document to get the bson.Raw of it.
+		b, err := bson.Marshal(bson.M{"v": val})
+		if err != nil {
+			return true, err
+		}
+		var doc struct {
+			V bson.Raw `bson:"v"`
+		}
+		if err = bson.Unmarshal(b, &doc); err != nil {
+			return true, err
+		}
+		if err = ptr.(bson.Setter).SetBSON(doc.V); err == bson.SetZero {
+			field.Set(reflect.Zero(field.Type()))
+			return true, nil
+		}
+		return true, err
+	case reflect.TypeOf(val) == field.Type():
+		// the types supported by bson, such as time.Time.
+		field.Set(reflect.ValueOf(val))
+		return true, nil
+	case d.format != "bson" && impl&implJSONUnmarshaler != 0:
+		b, err := json.Marshal(val)
+		if err != nil {
+			return true, err
+		}
+		return true, ptr.(json.Unmarshaler).UnmarshalJSON(b)
+	case impl&implTextUnmarshaler != 0:
+		s, ok := val.(string)
+		if !ok {
+			return false, nil
+		}
+		return true, ptr.(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+	default:
+		return false, nil
+	}
+}
+
+// stripName returns the fields of mp without the name of struct.
+func (d *decodeState) stripName(mp map[string]interface{}) map[string]interface{} {
+	name, fields := d.structName(mp)
+	if name == "" || d.nameStyle != propertyName {
+		return fields
+	}
+	rv := make(map[string]interface{}, len(fields))
+	for k, v := range fields {
+		if k != d.nameKey {
+			rv[k] = v
+		}
+	}
+	return rv
+}
@@ -0,0 +1,138 @@
+package reflectx
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Point is encoded as "x,y" by Reflector.
+type Point struct {
+	X, Y int
+}
+
+func (p Point) MarshalReflect() (interface{}, error) {
+	return map[string]interface{}{"xy": []interface{}{p.X, p.Y}}, nil
+}
+
+func (p *Point) UnmarshalReflect(v interface{}) error {
+	mp, ok := v.(map[string]interface{})
+	if !ok {
+		return errors.New("point: expected map")
+	}
+	xy, ok := mp["xy"].([]interface{})
+	if !ok || len(xy) != 2 {
+		return errors.New("point: invalid xy")
+	}
+	p.X = ValueOf(xy[0]).Int()
+	p.Y = ValueOf(xy[1]).Int()
+	return nil
+}
+
+// Level implements encoding.TextMarshaler.
+type Level int
+
+func (l Level) MarshalText() ([]byte, error) {
+	if l < 0 {
+		return nil, errors.New("level: negative")
+	}
+	return []byte(strings.Repeat("*", int(l))), nil
+}
+
+func (l *Level) UnmarshalText(b []byte) error {
+	*l = Level(len(b))
+	return nil
+}
+
+// Secret implements bson.Getter and bson.Setter.
+type Secret struct {
+	s string
+}
+
+func (s Secret) GetBSON() (interface{}, error) {
+	return "secret:" + s.s, nil
+}
+
+func (s *Secret) SetBSON(raw bson.Raw) error {
+	var str string
+	if err := raw.Unmarshal(&str); err != nil {
+		return err
+	}
+	s.s = strings.TrimPrefix(str, "secret:")
+	return nil
+}
+
+type Event struct {
+	At     time.Time
+	Timer  *time.Duration
+	Where  Point
+	Level  Level
+	Secret Secret
+	Extra  interface{}
+}
+
+func TestMarshaler(t *testing.T) {
+	at := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	for _, format := range []string{"json", "bson"} {
+		r := NewReflector(format, "", nil)
+		r.Register(Event{})
+		r.Register(Point{})
+
+		Convey("should honor marshalers with "+format, t, func() {
+			ev := Event{
+				At:     at,
+				Where:  Point{1, 2},
+				Level:  3,
+				Secret: Secret{"abc"},
+				Extra:  Point{3, 4},
+			}
+			data, err := r.Encode(ev)
+			So(err, ShouldBeNil)
+
+			var got Event
+			So(r.DecodeInto(data, &got), ShouldBeNil)
+			So(got.At.Equal(at), ShouldBeTrue)
+			So(got.Where, ShouldResemble, Point{1, 2})
+			So(got.Level, ShouldEqual, 3)
+			So(got.Extra, ShouldResemble, Point{3, 4})
+			if format == "bson" {
+				So(got.Secret, ShouldResemble, Secret{"abc"})
+			}
+
+			rv, err := r.Decode(data)
+			So(err, ShouldBeNil)
+			So(rv.(Event).Where, ShouldResemble, Point{1, 2})
+		})
+	}
+
+	r := NewReflector("json", "", nil)
+	r.Register(Event{})
+	r.Register(Point{})
+
+	Convey("should encode time.Time as string in json", t, func() {
+		data, err := r.Encode(map[string]interface{}{"at": at, "p": Point{1, 2}})
+		So(err, ShouldBeNil)
+		So(string(data), ShouldEqual, `{"at":"2020-01-02T03:04:05Z","p":{"_struct_name":"reflectx.Point","xy":[1,2]}}`)
+	})
+
+	Convey("should return error of marshaler", t, func() {
+		_, err := r.Encode(Event{Level: -1})
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "level: negative")
+	})
+
+	Convey("should return error of unmarshaler", t, func() {
+		var ev Event
+		err := r.DecodeInto([]byte(`{"Where":{"xy":[1]}}`), &ev)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "point: invalid xy at /Where")
+
+		err = r.DecodeInto([]byte(`{"At":"yesterday"}`), &ev)
+		So(err, ShouldNotBeNil)
+	})
+}
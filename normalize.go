@@ -0,0 +1,169 @@
+package reflectx
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// the options of form tags to normalize the input strings before binding,
+// they are applied in the order below whatever the order in the tag is:
+//	stripctl      removes the control characters except '\t', '\n' and '\r'
+//	nfc           normalizes to Unicode NFC
+//	collapse      replaces the runs of white space with a single ' '
+//	trim          removes the leading and trailing white space
+//	lower, upper  maps to lower or upper case
+//	normalize=a|b calls the normalizers registered by RegisterNormalizer
+//	truncate=n    keeps the first n characters at most
+// For example:
+//	Name string `form:"name,stripctl,collapse,trim,truncate=64"`
+const (
+	optStripControl = "stripctl"
+	optNFC          = "nfc"
+	optCollapse     = "collapse"
+	optTrim         = "trim"
+	optLower        = "lower"
+	optUpper        = "upper"
+	optNormalize    = "normalize"
+	optTruncate     = "truncate"
+)
+
+// NormalizeFunc returns the normalized s.
+type NormalizeFunc func(s string) string
+
+var normalizers sync.Map // map[string]NormalizeFunc
+
+// RegisterNormalizer registers the normalizer of name for the "normalize"
+// option of form tags, which is used by all FormMappers. Normalizers should
+// be registered before the types using them are mapped.
+//	RegisterNormalizer("slug", func(s string) string {
+//		return strings.ReplaceAll(strings.ToLower(s), " ", "-")
+//	})
+func RegisterNormalizer(name string, fn NormalizeFunc) {
+	if fn == nil {
+		panic("reflectx: nil normalizer for " + name)
+	}
+	normalizers.Store(name, fn)
+}
+
+// checkNormalizer panics if the "normalize" or "truncate" option of fi is
+// invalid, it is called when the field is mapped.
+func checkNormalizer(fi *FieldInfo) {
+	if names, ok := fi.Options[optNormalize]; ok {
+		for _, name := range strings.Split(names, "|") {
+			if _, ok := normalizers.Load(name); !ok {
+				panic("reflectx: unknown normalizer " + name + " of " + fi.Path)
+			}
+		}
+	}
+	if n, ok := fi.Options[optTruncate]; ok {
+		if max, err := strconv.Atoi(n); err != nil || max < 0 {
+			panic("reflectx: invalid truncate option of " + fi.Path + ": " + n)
+		}
+	}
+}
+
+// normalize returns strs normalized by the options of fi, strs is not
+// modified.
+func normalize(fi *FieldInfo, strs []string) []string {
+	if !hasNormalizer(fi) {
+		return strs
+	}
+	rv := make([]string, len(strs))
+	for i, s := range strs {
+		rv[i] = normalizeString(fi, s)
+	}
+	return rv
+}
+
+// hasNormalizer returns whether fi has any option to normalize strings.
+func hasNormalizer(fi *FieldInfo) bool {
+	for _, opt := range []string{optStripControl, optNFC, optCollapse, optTrim, optLower, optUpper, optNormalize, optTruncate} {
+		if _, ok := fi.Options[opt]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeString normalizes s by the options of fi, which are checked by
+// checkNormalizer.
+func normalizeString(fi *FieldInfo, s string) string {
+	has := func(opt string) bool {
+		_, ok := fi.Options[opt]
+		return ok
+	}
+
+	if has(optStripControl) {
+		s = strings.Map(func(r rune) rune {
+			if unicode.IsControl(r) && r != '\t' && r != '\n' && r != '\r' {
+				return -1
+			}
+			return r
+		}, s)
+	}
+	if has(optNFC) {
+		s = norm.NFC.String(s)
+	}
+	if has(optCollapse) {
+		s = collapseSpace(s)
+	}
+	if has(optTrim) {
+		s = strings.TrimSpace(s)
+	}
+	if has(optLower) {
+		s = strings.ToLower(s)
+	}
+	if has(optUpper) {
+		s = strings.ToUpper(s)
+	}
+	if names, ok := fi.Options[optNormalize]; ok {
+		for _, name := range strings.Split(names, "|") {
+			if fn, ok := normalizers.Load(name); ok {
+				s = fn.(NormalizeFunc)(s)
+			}
+		}
+	}
+	if n, ok := fi.Options[optTruncate]; ok {
+		if max, err := strconv.Atoi(n); err == nil && max >= 0 {
+			s = truncate(s, max)
+		}
+	}
+	return s
+}
+
+// collapseSpace replaces the runs of white space in s with a single ' '.
+func collapseSpace(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	space := false
+	for _, r := range s {
+		if unicode.IsSpace(r) {
+			space = true
+			continue
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		b.WriteRune(r)
+	}
+	if space {
+		b.WriteByte(' ')
+	}
+	return b.String()
+}
+
+// truncate returns the first n characters of s.
+func truncate(s string, n int) string {
+	for i := range s {
+		if n == 0 {
+			return s[:i]
+		}
+		n--
+	}
+	return s
+}
@@ -0,0 +1,86 @@
+package reflectx
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type Comment struct {
+	Author string   `form:"author,trim,lower"`
+	Code   string   `form:"code,trim,upper"`
+	Title  string   `form:"title,stripctl,collapse,trim,truncate=8"`
+	Body   string   `form:"body,stripctl"`
+	Name   string   `form:"name,nfc"`
+	Slug   string   `form:"slug,trim,normalize=slug"`
+	Tags   []string `form:"tags,trim,lower"`
+	Page   int      `form:"page,trim"`
+	Raw    string   `form:"raw"`
+}
+
+func TestNormalize(t *testing.T) {
+	RegisterNormalizer("slug", func(s string) string {
+		return strings.ReplaceAll(strings.ToLower(s), " ", "-")
+	})
+
+	form := map[string][]string{
+		"author": {"  Alice "},
+		"code":   {" ab1 "},
+		"title":  {" Hello\x00 \t\n  World "},
+		"body":   {"a\x1b[31m\nb\tc"},
+		"name":   {"Cafe\u0301"},
+		"slug":   {" Hello World "},
+		"tags":   {" Go ", "RUST"},
+		"page":   {" 3 "},
+		"raw":    {"  as is "},
+	}
+	var c Comment
+	assert.Nil(t, FormToStruct(form, &c))
+	assert.Equal(t, Comment{
+		Author: "alice",
+		Code:   "AB1",
+		Title:  "Hello Wo",
+		Body:   "a[31m\nb\tc",
+		Name:   "Caf\u00e9",
+		Slug:   "hello-world",
+		Tags:   []string{"go", "rust"},
+		Page:   3,
+		Raw:    "  as is ",
+	}, c)
+
+	// the value normalized to empty does not rewrite the field.
+	c = Comment{Page: 1}
+	assert.Nil(t, FormToStruct(map[string][]string{"page": {"  "}}, &c))
+	assert.Equal(t, 1, c.Page)
+
+	// truncate counts characters, not bytes.
+	c = Comment{}
+	assert.Nil(t, FormToStruct(map[string][]string{"title": {"你好世界你好世界你好"}}, &c))
+	assert.Equal(t, "你好世界你好世界", c.Title)
+
+	// invalid options panic when the struct is mapped, whatever the form is.
+	assert.Panics(t, func() {
+		type Bad struct {
+			S string `form:"s,normalize=unknown"`
+		}
+		FormToStruct(map[string][]string{}, &Bad{})
+	})
+	assert.Panics(t, func() {
+		type Bad struct {
+			S string `form:"s,truncate=-1"`
+		}
+		FormToStruct(map[string][]string{}, &Bad{})
+	})
+
+	// the strings of json body are normalized as well.
+	body := `{"author": " Bob ", "tags": [" A "]}`
+	r := httptest.NewRequest(http.MethodPost, "/comments", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	c = Comment{}
+	assert.Nil(t, NewBinder("", nil).Bind(r, &c))
+	assert.Equal(t, "bob", c.Author)
+	assert.Equal(t, []string{"a"}, c.Tags)
+}
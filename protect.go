@@ -0,0 +1,235 @@
+package reflectx
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// AllowFields binds only the fields of paths and the children of them, the
+// paths are mapped names of struct fields without indexes or map keys, such
+// as "name", "addr.city" or "items.qty". Use it with FormMapper.With to set
+// the allow-list per call.
+func AllowFields(paths ...string) FormOption {
+	return func(fm *FormMapper) {
+		fm.allow = paths
+	}
+}
+
+// DenyFields does not bind the fields of paths and the children of them,
+// the paths are the same as AllowFields.
+func DenyFields(paths ...string) FormOption {
+	return func(fm *FormMapper) {
+		fm.deny = paths
+	}
+}
+
+// BindGroups enables the fields tagged with "bindonly" of the groups, for
+// example, the field below is bound only with BindGroups("create"):
+//	ID string `form:"id,bindonly=create|import"`
+func BindGroups(groups ...string) FormOption {
+	return func(fm *FormMapper) {
+		fm.groups = groups
+	}
+}
+
+// With returns a copy of the FormMapper with opts, the mapping and
+// converters are shared with fm, for example:
+//	fm.With(DenyFields("role", "balance")).FormToStruct(form, &user)
+func (fm FormMapper) With(opts ...FormOption) FormMapper {
+	for _, opt := range opts {
+		opt(&fm)
+	}
+	return fm
+}
+
+// permitted returns whether the key split to segs can be bound to the
+// struct type t. The fields tagged with "readonly" are never bound.
+func (fm FormMapper) permitted(t reflect.Type, segs []string) bool {
+	return fm.allowed(fm.fieldPath(t, segs))
+}
+
+// allowed returns whether the field specified by path and fields returned by
+// fieldPath can be bound.
+func (fm FormMapper) allowed(path string, fields []*FieldInfo) bool {
+	if path == "" {
+		// unknown keys are ignored by binding.
+		return true
+	}
+	for _, fi := range fields {
+		if _, ok := fi.Options[ReadOnly]; ok {
+			return false
+		}
+		if groups, ok := fi.Options[BindOnly]; ok && !fm.inGroups(groups) {
+			return false
+		}
+	}
+	if len(fm.allow) > 0 && !matchPaths(fm.allow, path, true) {
+		return false
+	}
+	return !matchPaths(fm.deny, path, false)
+}
+
+// fieldPath returns the path of struct fields specified by segs, the
+// indexes of slices and keys of maps are skipped, for example, the path of
+// "items[0][name]" is "items.name". fields are the struct fields in the
+// path, including the flattened and embedded ones.
+func (fm FormMapper) fieldPath(t reflect.Type, segs []string) (string, []*FieldInfo) {
+	var names []string
+	var fields []*FieldInfo
+	for len(segs) > 0 {
+		t = Deref(t)
+		if fm.convs.has(t) {
+			break
+		}
+		switch t.Kind() {
+		case reflect.Struct:
+			// the segments are joined until a leaf is found, the same as bindPath.
+			sm := fm.mapper.TypeMap(t)
+			path, found := "", ""
+			i := 0
+			for ; i < len(segs); i++ {
+				path = joinPath(path, segs[i])
+				fi, ok := sm.Paths[path]
+				if !ok {
+					continue
+				}
+				for n := 1; n <= len(fi.Index); n++ {
+					if p := sm.GetByTraversal(fi.Index[:n]); p != nil {
+						fields = append(fields, p)
+					}
+				}
+				found, t = path, fi.Type
+				if fT := Deref(fi.Type); fT.Kind() != reflect.Struct || fm.convs.has(fT) {
+					break
+				}
+			}
+			if found == "" {
+				return "", nil
+			}
+			names = append(names, found)
+			if i >= len(segs) {
+				return strings.Join(names, "."), fields
+			}
+			segs = segs[i+1:]
+		case reflect.Slice, reflect.Array, reflect.Map:
+			t = t.Elem()
+			segs = segs[1:]
+		default:
+			segs = nil
+		}
+	}
+	return strings.Join(names, "."), fields
+}
+
+// inGroups returns whether one of the groups separated by '|' is enabled.
+func (fm FormMapper) inGroups(groups string) bool {
+	for _, g := range strings.Split(groups, "|") {
+		for _, enabled := range fm.groups {
+			if g == enabled {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchPaths returns whether path is one of paths or a child of them. If
+// parents is true, the parents of paths are matched as well.
+func matchPaths(paths []string, path string, parents bool) bool {
+	for _, p := range paths {
+		if path == p || strings.HasPrefix(path, p+".") {
+			return true
+		}
+		if parents && strings.HasPrefix(p, path+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// prune deletes the keys of val decoded from json or xml which are not
+// permitted, and prepares the strings by the options of fields. The strings
+// and json numbers of the fields with time options are parsed to time.Time,
+// the errors are appended to errs. t is the struct type of the top level,
+// segs is the key of val. It returns the prepared val.
+func (fm FormMapper) prune(t reflect.Type, segs []string, val interface{}, errs *BindErrors) interface{} {
+	switch vv := val.(type) {
+	case map[string]interface{}:
+		for k, elem := range vv {
+			keySegs := append(segs[:len(segs):len(segs)], k)
+			if !fm.permitted(t, keySegs) {
+				delete(vv, k)
+				continue
+			}
+			vv[k] = fm.prune(t, keySegs, elem, errs)
+		}
+	case []interface{}:
+		for i, elem := range vv {
+			elemSegs := append(segs[:len(segs):len(segs)], strconv.Itoa(i))
+			if s, ok := elem.(string); ok {
+				// the elements are not split.
+				vv[i] = fm.prepareString(t, elemSegs, s, false, errs)
+			} else {
+				vv[i] = fm.prune(t, elemSegs, elem, errs)
+			}
+		}
+	case string:
+		return fm.prepareString(t, segs, vv, true, errs)
+	case json.Number:
+		if leaf := fm.leafField(t, segs); leaf != nil {
+			return parseTime(leaf, segs, string(vv), errs)
+		}
+	}
+	return val
+}
+
+// prepareString normalizes s by the options of the field specified by segs,
+// a slice field with the "split" option is split to []interface{} if split
+// is true.
+func (fm FormMapper) prepareString(t reflect.Type, segs []string, s string, split bool, errs *BindErrors) interface{} {
+	leaf := fm.leafField(t, segs)
+	if leaf == nil {
+		return s
+	}
+	if _, ok := splitSep(leaf); !ok || !split {
+		return parseTime(leaf, segs, normalizeString(leaf, s), errs)
+	}
+	strs, err := stringValues{strs: []string{s}, leaf: leaf}.prepare()
+	if err != nil {
+		// leave it to the decoding.
+		return s
+	}
+	items := make([]interface{}, len(strs))
+	for i := range strs {
+		items[i] = parseTime(leaf, append(segs[:len(segs):len(segs)], strconv.Itoa(i)), strs[i], errs)
+	}
+	return items
+}
+
+// leafField returns the last struct field specified by segs, or nil if it is unknown.
+func (fm FormMapper) leafField(t reflect.Type, segs []string) *FieldInfo {
+	_, fields := fm.fieldPath(t, segs)
+	if len(fields) == 0 {
+		return nil
+	}
+	return fields[len(fields)-1]
+}
+
+// parseTime parses s to time.Time by the time options of fi, so that the
+// Reflector decodes it as is. s is returned if fi has no time option or s
+// is invalid, the error is appended to errs.
+func parseTime(fi *FieldInfo, segs []string, s string, errs *BindErrors) interface{} {
+	if fi.convs == nil {
+		return s
+	}
+	c, _ := fi.convs.lookup(timeType)
+	v := reflect.New(timeType).Elem()
+	if err := c.decode(s, v); err != nil {
+		path := strings.Join(segs, ".")
+		*errs = append(*errs, &BindError{Key: path, Path: path, Input: []string{s}, Type: timeType, Err: err})
+		return s
+	}
+	return v.Interface()
+}
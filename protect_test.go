@@ -0,0 +1,89 @@
+package reflectx
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type Member struct {
+	ID      string            `form:"id,bindonly=create|import"`
+	Name    string            `form:"name"`
+	Role    string            `form:"role,readonly"`
+	Balance int               `form:"balance"`
+	Addr    Address           `form:"addr"`
+	Items   []LineItem        `form:"items"`
+	Meta    map[string]string `form:"meta"`
+}
+
+func TestFieldPolicies(t *testing.T) {
+	form := map[string][]string{
+		"id":             {"7"},
+		"name":           {"alice"},
+		"role":           {"admin"},
+		"balance":        {"100"},
+		"addr.city":      {"paris"},
+		"items[0][name]": {"x"},
+		"items[0][qty]":  {"2"},
+		"meta[color]":    {"red"},
+	}
+
+	fm := NewFormMapper("", nil)
+	var m Member
+	assert.Nil(t, fm.FormToStruct(form, &m))
+	assert.Equal(t, Member{
+		Name:    "alice",
+		Balance: 100,
+		Addr:    Address{City: "paris"},
+		Items:   []LineItem{{Name: "x", Qty: 2}},
+		Meta:    map[string]string{"color": "red"},
+	}, m)
+
+	m = Member{}
+	assert.Nil(t, fm.With(BindGroups("create")).FormToStruct(form, &m))
+	assert.Equal(t, "7", m.ID)
+	assert.Equal(t, "", m.Role)
+
+	// the paths are the fields without indexes and keys.
+	m = Member{}
+	assert.Nil(t, fm.With(DenyFields("balance", "items.qty", "meta")).FormToStruct(form, &m))
+	assert.Equal(t, Member{
+		Name:  "alice",
+		Addr:  Address{City: "paris"},
+		Items: []LineItem{{Name: "x"}},
+	}, m)
+
+	m = Member{}
+	assert.Nil(t, fm.With(AllowFields("name", "addr", "items.name")).FormToStruct(form, &m))
+	assert.Equal(t, Member{
+		Name:  "alice",
+		Addr:  Address{City: "paris"},
+		Items: []LineItem{{Name: "x"}},
+	}, m)
+
+	// the options of fm are not changed by With.
+	m = Member{}
+	assert.Nil(t, fm.FormToStruct(map[string][]string{"balance": {"1"}}, &m))
+	assert.Equal(t, 1, m.Balance)
+}
+
+func TestBinderFieldPolicies(t *testing.T) {
+	binder := NewBinder("", nil).With(DenyFields("balance", "items.qty"))
+
+	body := `{"name": "alice", "role": "admin", "balance": 100, "items": [{"name": "x", "qty": 2}]}`
+	r := httptest.NewRequest(http.MethodPost, "/members?role=admin&balance=1", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	var m Member
+	assert.Nil(t, binder.Bind(r, &m))
+	assert.Equal(t, Member{Name: "alice", Items: []LineItem{{Name: "x"}}}, m)
+
+	body = `<member><name>alice</name><role>admin</role><balance>100</balance></member>`
+	r = httptest.NewRequest(http.MethodPost, "/members", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/xml")
+	m = Member{}
+	assert.Nil(t, binder.Bind(r, &m))
+	assert.Equal(t, Member{Name: "alice"}, m)
+}
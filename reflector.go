@@ -1,15 +1,24 @@
 package reflectx
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"reflect"
+	"sort"
+	"sync"
 
 	"gopkg.in/mgo.v2/bson"
 )
 
 var (
 	StructNameKey = "_struct_name"
+	// IDKey marks the id of a pointer, RefKey refers to the pointer with the id,
+	// they are only used with KeepReferences.
+	IDKey  = "$id"
+	RefKey = "$ref"
 )
 
 // json.Unmarshal or xml.Unmarshal only can decode bytes to map[]interface{},
@@ -17,21 +26,206 @@ var (
 // Reflector can decode bytes to registed structs.
 type Reflector interface {
 	Register(v interface{})
+	RegisterInterface(iface interface{}, impls ...interface{})
+	RegisterConverter(t reflect.Type, encode EncodeFunc, decode DecodeFunc)
 	Encode(v interface{}) ([]byte, error)
+	Hash(v interface{}) ([]byte, error)
 	Decode(b []byte) (interface{}, error)
+	DecodeInto(b []byte, ptr interface{}) error
+	NewEncoder(w io.Writer) *Encoder
+	NewDecoder(rd io.Reader) *Decoder
+	With(opts ...ReflectorOption) Reflector
 }
 
+// the styles to mark the name of struct.
+const (
+	propertyName = iota // {"_struct_name": "T", "field": ...}
+	envelopeName        // {"type": "T", "value": {"field": ...}}
+	externalName        // {"T": {"field": ...}}
+)
+
 type reflector struct {
 	mapper    *Mapper
+	ifaces    *sync.Map //map[reflect.Type]map[string]reflect.Type, implementations of interfaces.
+	convs     *converters
+	format    string
 	marshal   func(v interface{}) ([]byte, error)
 	unmarshal func(b []byte, v interface{}) error
+
+	nameStyle      int
+	nameKey        string // key of the struct name, used by propertyName and envelopeName.
+	valueKey       string // key of the struct fields, used by envelopeName.
+	omitStaticName bool
+	keepRefs       bool
+	keepEmpty      bool
+	keepNilElems   bool
+	unknownFields  UnknownFieldPolicy
+	collectErrors  bool
+	singleToSlice  bool       // decode a single value to a slice, used to bind xml.
+	validator      *Validator // validates the decoded structs, nil means no validation.
+
+	// limits of decoding, 0 means no limit.
+	maxDepth    int
+	maxElements int
+	maxLength   int
+	allowed     map[string]bool // the struct names allowed to decode, nil means all.
+}
+
+// ReflectorOption configures a Reflector created by NewReflector.
+type ReflectorOption func(r *reflector)
+
+// WithNameKey marks the name of struct as a property with key, which is
+// the default style with StructNameKey.
+//	{"key": "T", "field": ...}
+func WithNameKey(key string) ReflectorOption {
+	return func(r *reflector) {
+		r.nameStyle = propertyName
+		r.nameKey = key
+	}
+}
+
+// WithEnvelope wraps the struct with the name of it, for example:
+//	{"typeKey": "T", "valueKey": {"field": ...}}
+func WithEnvelope(typeKey, valueKey string) ReflectorOption {
+	return func(r *reflector) {
+		r.nameStyle = envelopeName
+		r.nameKey = typeKey
+		r.valueKey = valueKey
+	}
+}
+
+// WithExternalTag uses the name of struct as the only key of the map, for example:
+//	{"T": {"field": ...}}
+// Note that a map with only one key equal to a registered struct name
+// will be decoded to the struct.
+func WithExternalTag() ReflectorOption {
+	return func(r *reflector) {
+		r.nameStyle = externalName
+	}
+}
+
+// OmitStaticName omits the name of struct if the type of it is known
+// by the field, the slice element or the map element, in other words,
+// the name is only marked for interface{}, the top level value or the
+// values with "$id" of KeepReferences.
+func OmitStaticName() ReflectorOption {
+	return func(r *reflector) {
+		r.omitStaticName = true
+	}
+}
+
+// KeepReferences assigns ids to the structs that pointers point to, the
+// repeated pointers are encoded as {"$ref": id}, so that shared or cyclic
+// pointers can be restored by decoding, for example:
+//	{"_struct_name": "T", "$id": 1, "Parent": {"$ref": 1}}
+// Note that only pointers to struct are tracked. Decode returns *T rather
+// than T for a top level struct with "$id", so that the references to it
+// point to the returned value, and DecodeInto points them to the target.
+func KeepReferences() ReflectorOption {
+	return func(r *reflector) {
+		r.keepRefs = true
+	}
+}
+
+// KeepEmptyCollections encodes the empty slices and maps as [] and {}, which
+// are omitted by default. Nil slices and maps are still omitted, so that an
+// empty collection can be distinguished from an absent one.
+func KeepEmptyCollections() ReflectorOption {
+	return func(r *reflector) {
+		r.keepEmpty = true
+	}
+}
+
+// KeepNilElements encodes the nil elements of maps as null, which are omitted
+// by default. Note that the nil elements of slices are always encoded as null
+// to keep the indexes of the others.
+func KeepNilElements() ReflectorOption {
+	return func(r *reflector) {
+		r.keepNilElems = true
+	}
+}
+
+// UnknownFieldPolicy decides how to decode the keys which are not paths of the struct.
+type UnknownFieldPolicy int
+
+// The unknown keys are always put into the map field with the "remain"
+// option if the struct has one, whatever the policy is, for example:
+//	type T struct {
+//		Name  string
+//		Extra map[string]interface{} `reflector:",remain"`
+//	}
+// The keys of the remain field are encoded into the parent level, so that
+// the struct can decode what it encodes.
+const (
+	// StrictUnknownFields returns an error for unknown keys, which is the default.
+	StrictUnknownFields UnknownFieldPolicy = iota
+	// IgnoreUnknownFields skips unknown keys.
+	IgnoreUnknownFields
+	// CollectUnknownFields puts unknown keys into the remain field, or skips
+	// them if there is no such field.
+	CollectUnknownFields
+)
+
+// WithUnknownFields sets the policy for the keys which are not paths of the struct.
+func WithUnknownFields(policy UnknownFieldPolicy) ReflectorOption {
+	return func(r *reflector) {
+		r.unknownFields = policy
+	}
+}
+
+// CollectErrors goes on decoding after errors, and returns all of them as
+// DecodeErrors. Otherwise decoding stops at the first *DecodeError.
+func CollectErrors() ReflectorOption {
+	return func(r *reflector) {
+		r.collectErrors = true
+	}
+}
+
+// WithMaxDepth limits the nesting depth of maps and slices to decode.
+func WithMaxDepth(n int) ReflectorOption {
+	return func(r *reflector) {
+		r.maxDepth = n
+	}
+}
+
+// WithMaxElements limits the total number of map entries and slice elements to decode.
+func WithMaxElements(n int) ReflectorOption {
+	return func(r *reflector) {
+		r.maxElements = n
+	}
+}
+
+// WithMaxLength limits the length of strings, map keys, bytes and json numbers
+// to decode.
+func WithMaxLength(n int) ReflectorOption {
+	return func(r *reflector) {
+		r.maxLength = n
+	}
+}
+
+// AllowTypes limits the struct names which can be decoded by the names in
+// data, such as the top level of Decode and interface fields. Use it with
+// Reflector.With to set the allow-list per call, for example:
+//	r.With(AllowTypes("pkg.Foo", "pkg.Bar")).Decode(b)
+// Note that the limits of decoding are checked after unmarshaling bytes, so
+// the size of bytes should be limited as well.
+func AllowTypes(names ...string) ReflectorOption {
+	return func(r *reflector) {
+		r.allowed = make(map[string]bool, len(names))
+		for _, name := range names {
+			r.allowed[name] = true
+		}
+	}
 }
 
 // opts can set format and tagName
+// format can be "json", "indentedjson", "canonicaljson" or "bson"
+// "canonicaljson" is json canonicalized by RFC 8785, for hashing and signing
 // default format is json
 // default tagName is "reflector"
 // default tagFunc is StdTagfunc
-func NewReflector(format, tagName string, tagFunc TagFunc) Reflector {
+// default style to mark the name of struct is WithNameKey(StructNameKey)
+func NewReflector(format, tagName string, tagFunc TagFunc, opts ...ReflectorOption) Reflector {
 	if format == "" {
 		format = "indentedjson"
 	}
@@ -39,7 +233,15 @@ func NewReflector(format, tagName string, tagFunc TagFunc) Reflector {
 		tagName = "reflector"
 	}
 	r := reflector{
-		mapper: NewMapper(tagName, tagFunc),
+		mapper:  NewMapper(tagName, tagFunc),
+		ifaces:  &sync.Map{},
+		convs:   &converters{},
+		nameKey: StructNameKey,
+		format:  format,
+	}
+	r.mapper.convs = r.convs
+	for _, opt := range opts {
+		opt(&r)
 	}
 
 	switch format {
@@ -52,38 +254,114 @@ func NewReflector(format, tagName string, tagFunc TagFunc) Reflector {
 	//r.unmarshal = xml.Unmarshal
 	case "json":
 		r.marshal = json.Marshal
-		r.unmarshal = json.Unmarshal
+		r.unmarshal = unmarshalJSON
+	case "canonicaljson":
+		r = r.canonicalize()
 	case "indentedjson":
 		r.marshal = func(v interface{}) ([]byte, error) {
 			return json.MarshalIndent(v, "", "    ")
 		}
-		r.unmarshal = json.Unmarshal
+		r.unmarshal = unmarshalJSON
 	default:
 		panic("unknown format name: " + format)
 	}
 	return r
 }
 
+// unmarshalJSON is the same as json.Unmarshal, but numbers are decoded to
+// json.Number instead of float64, so int64 and uint64 do not lose precision.
+func unmarshalJSON(b []byte, v interface{}) error {
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	if err := d.Decode(v); err != nil {
+		return err
+	}
+	if _, err := d.Token(); err != io.EOF {
+		return errors.New("reflectx: invalid data after top-level value")
+	}
+	return nil
+}
+
 // Before Decode, Register or Encode must be called first.
 // v surpossed to have a struct type.
 func (r reflector) Register(v interface{}) {
 	r.mapper.TypeMap(Deref(reflect.TypeOf(v)))
 }
 
+// RegisterInterface registers the struct types allowed to be decoded into
+// the interface type that iface points to, for example:
+//	r.RegisterInterface((*Shape)(nil), Circle{}, &Square{})
+// If only the pointer of the struct implements the interface, the pointer is
+// stored in the interface after decoding.
+// Decoding a struct which is not registered into the interface returns an error.
+func (r reflector) RegisterInterface(iface interface{}, impls ...interface{}) {
+	ifaceT := reflect.TypeOf(iface)
+	MustBe(ifaceT, reflect.Ptr)
+	ifaceT = ifaceT.Elem()
+	MustBe(ifaceT, reflect.Interface)
+
+	mp := make(map[string]reflect.Type, len(impls))
+	if v, ok := r.ifaces.Load(ifaceT); ok {
+		for k, t := range v.(map[string]reflect.Type) {
+			mp[k] = t
+		}
+	}
+	for _, impl := range impls {
+		implT := Deref(reflect.TypeOf(impl))
+		r.mapper.TypeMap(implT)
+		if !implT.Implements(ifaceT) {
+			implT = reflect.PtrTo(implT)
+			if !implT.Implements(ifaceT) {
+				panic(implT.Elem().String() + " does not implement " + ifaceT.String())
+			}
+		}
+		mp[Deref(implT).String()] = implT
+	}
+	r.ifaces.Store(ifaceT, mp)
+}
+
+// RegisterConverter registers the converter of type t to the Reflector, the
+// value is encoded as string. It is prior to the one registered by the package
+// level RegisterConverter and the marshaler interfaces.
+func (r reflector) RegisterConverter(t reflect.Type, encode EncodeFunc, decode DecodeFunc) {
+	r.convs.register(t, encode, decode)
+}
+
+// With returns a copy of the Reflector with opts, the registered types,
+// interfaces and converters are shared with r.
+func (r reflector) With(opts ...ReflectorOption) Reflector {
+	for _, opt := range opts {
+		opt(&r)
+	}
+	return r
+}
+
 // obj can be a struct or map[string]interface{}
 func (r reflector) Encode(obj interface{}) ([]byte, error) {
-	typ, val := Indirect(obj)
+	typ := Deref(reflect.TypeOf(obj))
+	e := newEncodeState(r)
 	if typ.Kind() == reflect.Struct {
-		fi := r.mapper.TypeMap(typ).Tree
-		rv := r.encode(fi, val)
+		// the name of struct is always marked at the top level.
+		rv := e.encode(nil, reflect.ValueOf(obj))
+		if e.err != nil {
+			return nil, e.err
+		}
 		return r.marshal(rv)
 	}
 
 	if mp, ok := obj.(map[string]interface{}); ok {
+		// encode in order of keys, so that the ids of references are stable.
+		keys := make([]string, 0, len(mp))
+		for k := range mp {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
 		rv := make(map[string]interface{}, len(mp))
-		for k, v := range mp {
-			_, vv := Indirect(v)
-			rv[k] = r.encode(nil, vv)
+		for _, k := range keys {
+			rv[k] = e.encode(nil, reflect.ValueOf(mp[k]))
+		}
+		if e.err != nil {
+			return nil, e.err
 		}
 		return r.marshal(rv)
 	}
@@ -93,183 +371,118 @@ func (r reflector) Encode(obj interface{}) ([]byte, error) {
 
 // Decode decodes bytes to a struct.
 // Before Decode, Register or Encode must be called first.
+// The struct is returned as T, or *T if it has "$id" with KeepReferences.
 func (r reflector) Decode(b []byte) (interface{}, error) {
 	var mp map[string]interface{}
 	if err := r.unmarshal(b, &mp); err != nil {
 		return nil, err
 	}
 
-	return r.decode(mp)
+	d, err := newDecodeState(r, mp)
+	if err != nil {
+		return nil, err
+	}
+	rv, err := d.decode(mp)
+	return rv, r.validate(reflect.ValueOf(rv), d.result(err))
 }
 
-// decode decodes a interface{} to reflect.Value.
-// The name of the struct store in the map with StructNameKey.
-func (r reflector) decode(val interface{}) (rv interface{}, err error) {
-	switch vv := val.(type) {
-	case map[string]interface{}:
-		if len(vv) == 0 {
-			return vv, nil
-		}
-		structName := getStructName(vv)
-		if structName == "" {
-			mp := make(map[string]interface{}, len(vv))
-			for k, v := range vv {
-				if mp[k], err = r.decode(v); err != nil {
-					return nil, err
-				}
-			}
-			return mp, nil
-		}
-		sm, ok := r.mapper.NameMap(structName)
-		if !ok {
-			return nil, errors.New("reflectx: unknown struct name: " + structName)
-		}
-		return r.mapToStruct(vv, &sm, "")
-	case []interface{}:
-		if len(vv) == 0 {
-			return vv, nil
-		}
-		s := make([]interface{}, len(vv))
-		for i := 0; i < len(vv); i++ {
-			if s[i], err = r.decode(vv[i]); err != nil {
-				return nil, err
-			}
-		}
-		return s, nil
-	default:
-		return vv, nil
-	}
+// DecodeInto decodes bytes to the struct, slice or map that ptr points to.
+// Unlike Decode, the top level of bytes does not need the struct name, it is
+// only required where the static type is interface{}.
+func (r reflector) DecodeInto(b []byte, ptr interface{}) error {
+	return r.decodeFrom(func(v interface{}) error {
+		return r.unmarshal(b, v)
+	}, ptr)
 }
 
-// mapToStruct converts a map[string]interface{} to a struct.
-// The name of the struct store in the map with StructNameKey.
-func (r reflector) mapToStruct(mp map[string]interface{}, sm *StructMap, prefix string) (interface{}, error) {
-	structV := Alloc(sm.Tree.Type)
-	structT := Deref(structV.Type())
-	for k, v := range mp {
-		if k == StructNameKey {
-			continue
-		}
-		if v == nil {
-			// nil field
-			continue
-		}
+// decodeFrom reads a value by unmarshal, and decodes it to ptr.
+func (r reflector) decodeFrom(unmarshal func(v interface{}) error, ptr interface{}) error {
+	v := reflect.ValueOf(ptr)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return fmt.Errorf("reflectx: DecodeInto expects a non-nil pointer, got %T", ptr)
+	}
 
-		if prefix != "" {
-			k = prefix + "." + k
+	var val interface{}
+	switch Deref(v.Type().Elem()).Kind() {
+	case reflect.Struct, reflect.Map:
+		// bson can only decode a document to map.
+		var mp map[string]interface{}
+		if err := unmarshal(&mp); err != nil {
+			return err
 		}
-
-		fi := sm.GetByPath(k)
-		if fi == nil {
-			return nil, errors.New("reflectx: " + k + " is not a path in struct " + structT.String())
+		val = mp
+	default:
+		if err := unmarshal(&val); err != nil {
+			return err
 		}
+	}
 
-		fieldV := FieldByIndexes(structV, fi.Index)
-		field, err := r.decode(v)
-		if err != nil {
-			return nil, err
-		}
-		if err := SetValue(fieldV, reflect.ValueOf(field)); err != nil {
-			return nil, err
-		}
+	d, err := newDecodeState(r, val)
+	if err != nil {
+		return err
 	}
-	return structV.Interface(), nil
+	return r.validate(v.Elem(), d.result(d.decodeInto(val, v.Elem())))
 }
 
-//encode encodes a struct to map[string]interface{}, mark the name of the struct with StructNameKey.
-func (r reflector) encode(fi *FieldInfo, val reflect.Value) interface{} {
-	if val.Kind() == reflect.Interface {
-		//get the real type of the interface
-		val = reflect.ValueOf(val.Interface())
+// validate validates the decoded struct v by the Validator of r if decoding
+// succeeded, the values other than structs are not validated.
+func (r reflector) validate(v reflect.Value, err error) error {
+	if err != nil || r.validator == nil || !v.IsValid() || Deref(v.Type()).Kind() != reflect.Struct {
+		return err
 	}
+	return r.validator.validate(v, r.mapper)
+}
 
-	fT, fV := getField(fi, val)
-	//skip invalid value or nil ptr.
-	if !fV.IsValid() {
-		return nil
+// markName marks the name of struct to the fields map.
+func (r reflector) markName(name string, fields map[string]interface{}) map[string]interface{} {
+	switch r.nameStyle {
+	case envelopeName:
+		return map[string]interface{}{r.nameKey: name, r.valueKey: fields}
+	case externalName:
+		return map[string]interface{}{name: fields}
+	default:
+		fields[r.nameKey] = name
+		return fields
 	}
+}
 
-	switch fT.Kind() {
-	case reflect.Struct:
-		if fi == nil {
-			fi = r.mapper.TypeMap(fT).Tree
+// structName returns the name of struct and the fields map marked by markName.
+// It returns an empty name and mp itself if no name is found.
+func (r reflector) structName(mp map[string]interface{}) (name string, fields map[string]interface{}) {
+	switch r.nameStyle {
+	case envelopeName:
+		if name, _ = mp[r.nameKey].(string); name != "" {
+			fields, _ = mp[r.valueKey].(map[string]interface{})
+			return name, fields
 		}
-		mp := make(map[string]interface{}, len(fi.Children)+1)
-		mp[StructNameKey] = fT.String()
-
-		for _, child := range fi.Children {
-			if elem := r.encode(child, val); elem != nil {
-				mp[child.Name] = elem
+	case externalName:
+		if len(mp) == 1 {
+			for k, v := range mp {
+				if _, ok := r.mapper.NameMap(k); ok {
+					fields, _ = v.(map[string]interface{})
+					return k, fields
+				}
 			}
 		}
-		return mp
-	case reflect.Slice:
-		numElems := fV.Len()
-		elemT := Deref(fT.Elem())
-		if numElems == 0 {
-			return nil
-		}
-		var elemFi *FieldInfo
-		if elemT.Kind() == reflect.Struct {
-			elemFi = r.mapper.TypeMap(elemT).Tree
-		}
-		var slice []interface{}
-		for i := 0; i < numElems; i++ {
-			// append nil elem or not?
-			elem := r.encode(elemFi, fV.Index(i))
-			slice = append(slice, elem)
-		}
-		return slice
-	case reflect.Map:
-		keyT := fT.Key()
-		elemT := Deref(fT.Elem())
-		numElems := fV.Len()
-		if numElems == 0 {
-			return nil
-		}
-
-		//convert to map[key]interface{}
-		mapType := reflect.MapOf(keyT, reflect.TypeOf((*interface{})(nil)).Elem())
-		mp := reflect.MakeMapWithSize(mapType, numElems)
-		var elemFi *FieldInfo
-		if elemT.Kind() == reflect.Struct {
-			elemFi = r.mapper.TypeMap(elemT).Tree
-		}
-
-		for _, k := range fV.MapKeys() {
-			// append nil elem or not?
-			elem := r.encode(elemFi, fV.MapIndex(k))
-			mp.SetMapIndex(k, reflect.ValueOf(elem))
-		}
-		return mp.Interface()
 	default:
-		return fV.Interface()
-	}
-}
-
-func getField(fi *FieldInfo, val reflect.Value) (fT reflect.Type, fV reflect.Value) {
-	if fi != nil {
-		fV = FieldByIndexesReadOnly(val, fi.Index)
-	} else {
-		fV = val
-	}
-	fV = reflect.Indirect(fV)
-	//skip invalid value or nil ptr.
-	if fV.IsValid() {
-		fT = fV.Type()
-		if fT.Kind() == reflect.Interface {
-			//get the real type of the interface, fV may be invalid because fV.Interface() may be nil.
-			fV = reflect.Indirect(reflect.ValueOf(fV.Interface()))
-			fT = fV.Type()
+		if name, _ = mp[r.nameKey].(string); name != "" {
+			return name, mp
 		}
 	}
-	return
+	return "", mp
 }
 
-func getStructName(mp map[string]interface{}) (name string) {
-	structName := mp[StructNameKey]
-	if structName != nil {
-		name, _ = structName.(string)
+// wrapperKey returns the key that wraps the fields of the struct name, such
+// as the value key of WithEnvelope, or "" if the fields are not wrapped.
+func (r reflector) wrapperKey(name string) string {
+	if name == "" {
+		return ""
+	}
+	switch r.nameStyle {
+	case envelopeName:
+		return r.valueKey
+	case externalName:
+		return name
 	}
-	return name
+	return ""
 }
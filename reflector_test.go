@@ -1,7 +1,12 @@
 package reflectx
 
 import (
+	"encoding/json"
+	"errors"
+	"math"
+	"reflect"
 	"testing"
+	"time"
 
 	. "github.com/smartystreets/goconvey/convey"
 )
@@ -254,10 +259,15 @@ func testDecode(t *testing.T, format string) {
 	i := 1
 	s := "string"
 	bar := Bar{&i, &s}
+	// numbers will be decoded to json.Number for json, float64 is kept for bson.
+	var number interface{} = json.Number("1")
+	if format == "bson" {
+		number = 1.0
+	}
 	mp := map[string]interface{}{
-		"float64": 1.0, // int will be decoded to float64 for json.
-		"struct":  struct{}{},
-		"bar":     bar,
+		"number": number,
+		"struct": struct{}{},
+		"bar":    bar,
 	}
 	f := Foo{
 		F: 1,
@@ -325,7 +335,7 @@ func testDecode(t *testing.T, format string) {
 		So(err, ShouldBeNil)
 
 		_, err = r.Decode(b)
-		So(err.Error(), ShouldEqual, `reflectx: strconv.ParseInt: parsing "expected int, got string": invalid syntax`)
+		So(err.Error(), ShouldEqual, `reflectx: strconv.ParseInt: parsing "expected int, got string": invalid syntax at /B`)
 	})
 
 	Convey("should return struct type mismatch", t, func() {
@@ -357,6 +367,804 @@ func testDecode(t *testing.T, format string) {
 		So(err, ShouldBeNil)
 
 		_, err = r.Decode(b)
-		So(err.Error(), ShouldEqual, "reflectx: type mismatch, expected reflectx.Foo, got reflectx.Bar")
+		So(err.Error(), ShouldEqual, "reflectx: type mismatch, expected reflectx.Foo, got reflectx.Bar at /F")
+	})
+}
+
+func TestDecodeInto(t *testing.T) {
+	i := 1
+	s := "string"
+	bar := Bar{&i, &s}
+	f := Foo{
+		F: 1,
+		O: map[string]interface{}{
+			"string": "string",
+			"bar":    bar,
+		},
+	}
+	sf := []Foo{f, f}
+	psf := []*Foo{&f, nil, &f}
+	fb := FooBar{
+		Foo:    f,
+		Bar:    bar,
+		PBar:   &bar,
+		SFoo:   sf,
+		PSFoo:  &sf,
+		PSPFoo: &psf,
+	}
+
+	for _, format := range []string{"json", "bson"} {
+		r := NewReflector(format, "", nil)
+		r.Register(Bar{})
+
+		Convey("should decode into struct correctly with "+format, t, func() {
+			b, err := r.Encode(fb)
+			So(err, ShouldBeNil)
+
+			var rv FooBar
+			So(r.DecodeInto(b, &rv), ShouldBeNil)
+			So(rv, ShouldResemble, fb)
+
+			prv := &FooBar{}
+			So(r.DecodeInto(b, &prv), ShouldBeNil)
+			So(*prv, ShouldResemble, fb)
+		})
+
+		Convey("should decode into map correctly with "+format, t, func() {
+			b, err := r.Encode(map[string]interface{}{"a": bar, "b": bar})
+			So(err, ShouldBeNil)
+
+			var rv map[string]Bar
+			So(r.DecodeInto(b, &rv), ShouldBeNil)
+			So(rv, ShouldResemble, map[string]Bar{"a": bar, "b": bar})
+		})
+	}
+
+	r := NewReflector("json", "", nil)
+	r.Register(Bar{})
+
+	Convey("should decode legacy payload without struct name", t, func() {
+		var rv FooBar
+		err := r.DecodeInto([]byte(`{
+			"B": 1,
+			"Ar": "string",
+			"F": {"f": 1, "O": {"string": "string", "bar": {"_struct_name": "reflectx.Bar", "B": 1, "Ar": "string"}}},
+			"PBar": {"B": 1, "Ar": "string"},
+			"SFoo": [{"f": 1}, {"f": 2}],
+			"PSPFoo": [{"f": 1}, null]
+		}`), &rv)
+		So(err, ShouldBeNil)
+		So(rv.Foo, ShouldResemble, f)
+		So(rv.Bar, ShouldResemble, bar)
+		So(rv.PBar, ShouldResemble, &bar)
+		So(rv.SFoo, ShouldResemble, []Foo{{F: 1}, {F: 2}})
+		So(rv.PSFoo, ShouldBeNil)
+		So(*rv.PSPFoo, ShouldResemble, []*Foo{{F: 1}, nil})
+	})
+
+	Convey("should decode into slice correctly", t, func() {
+		var rv []*Bar
+		So(r.DecodeInto([]byte(`[{"B": 1, "Ar": "string"}, null]`), &rv), ShouldBeNil)
+		So(rv, ShouldResemble, []*Bar{&bar, nil})
+	})
+
+	Convey("should return errors", t, func() {
+		var rv FooBar
+		So(r.DecodeInto([]byte(`{}`), rv).Error(), ShouldEqual, "reflectx: DecodeInto expects a non-nil pointer, got reflectx.FooBar")
+
+		err := r.DecodeInto([]byte(`{"F": {"_struct_name": "reflectx.Bar"}}`), &rv)
+		So(err.Error(), ShouldEqual, "reflectx: type mismatch, expected reflectx.Foo, got reflectx.Bar at /F")
+
+		err = r.DecodeInto([]byte(`{"F": 1}`), &rv)
+		So(err.Error(), ShouldEqual, "reflectx: type mismatch, expected reflectx.Foo, got json.Number at /F")
+
+		err = r.DecodeInto([]byte(`{"X": 1}`), &rv)
+		So(err.Error(), ShouldEqual, "reflectx: X is not a path in struct reflectx.FooBar at /X")
+	})
+}
+
+func TestDecodeNumbers(t *testing.T) {
+	type Numbers struct {
+		MaxInt64  int64
+		MinInt64  int64
+		MaxUint64 uint64
+		PUint64   *uint64
+		Float64   float64
+		Int8      int8
+		I         interface{}
+		S         []interface{}
+	}
+
+	u := uint64(math.MaxUint64)
+	n := Numbers{
+		MaxInt64:  math.MaxInt64,
+		MinInt64:  math.MinInt64,
+		MaxUint64: math.MaxUint64,
+		PUint64:   &u,
+		Float64:   math.MaxFloat64,
+		Int8:      math.MinInt8,
+	}
+
+	for _, format := range []string{"json", "indentedjson", "bson"} {
+		r := NewReflector(format, "", nil)
+		r.Register(Numbers{})
+		n := n
+		if format == "bson" {
+			// BSON has no uint64 type.
+			n.MaxUint64 = math.MaxInt64
+			n.PUint64 = &n.MaxUint64
+		}
+
+		Convey("should keep the precision of numbers with "+format, t, func() {
+			b, err := r.Encode(n)
+			So(err, ShouldBeNil)
+
+			rv, err := r.Decode(b)
+			So(err, ShouldBeNil)
+			So(rv, ShouldResemble, n)
+
+			var tmp Numbers
+			So(r.DecodeInto(b, &tmp), ShouldBeNil)
+			So(tmp, ShouldResemble, n)
+		})
+	}
+
+	r := NewReflector("json", "", nil)
+	r.Register(Numbers{})
+
+	Convey("should decode numbers in interface{} to json.Number", t, func() {
+		var tmp Numbers
+		So(r.DecodeInto([]byte(`{"I": 18446744073709551615, "S": [9223372036854775807, 1.5]}`), &tmp), ShouldBeNil)
+		So(tmp.I, ShouldEqual, json.Number("18446744073709551615"))
+		So(ValueOf(tmp.I).MustUint64(), ShouldEqual, uint64(math.MaxUint64))
+		So(tmp.S, ShouldResemble, []interface{}{json.Number("9223372036854775807"), json.Number("1.5")})
+		So(ValueOf(tmp.S[0]).MustInt64(), ShouldEqual, int64(math.MaxInt64))
+		So(ValueOf(tmp.S[1]).MustFloat(), ShouldEqual, 1.5)
+	})
+
+	Convey("should return errors for overflow and invalid data", t, func() {
+		var tmp Numbers
+		So(r.DecodeInto([]byte(`{"MaxInt64": 9223372036854775808}`), &tmp), ShouldNotBeNil)
+		So(r.DecodeInto([]byte(`{"Int8": 128}`), &tmp), ShouldNotBeNil)
+		So(r.DecodeInto([]byte(`{"MaxUint64": 1.5}`), &tmp), ShouldNotBeNil)
+		So(r.DecodeInto([]byte(`{} {}`), &tmp).Error(), ShouldEqual, "reflectx: invalid data after top-level value")
+	})
+}
+
+type Shape interface {
+	Area() float64
+}
+
+type Circle struct {
+	R float64
+}
+
+func (c Circle) Area() float64 { return 3 * c.R * c.R }
+
+type Square struct {
+	L float64
+}
+
+func (s *Square) Area() float64 { return s.L * s.L }
+
+type Triangle struct {
+	B, H float64
+}
+
+func (t Triangle) Area() float64 { return t.B * t.H / 2 }
+
+type Drawing struct {
+	Main   Shape
+	Shapes []Shape
+}
+
+func TestRegisterInterface(t *testing.T) {
+	r := NewReflector("json", "", nil)
+	r.RegisterInterface((*Shape)(nil), Circle{}, Square{})
+	r.Register(Drawing{})
+	r.Register(Triangle{})
+
+	Convey("should decode registered implementations", t, func() {
+		d := Drawing{
+			Main:   Circle{1},
+			Shapes: []Shape{Circle{2}, &Square{3}, nil},
+		}
+		b, err := r.Encode(d)
+		So(err, ShouldBeNil)
+
+		rv, err := r.Decode(b)
+		So(err, ShouldBeNil)
+		So(rv, ShouldResemble, d)
+
+		var shapes []Shape
+		So(r.DecodeInto([]byte(`[{"_struct_name": "reflectx.Square", "L": 2}]`), &shapes), ShouldBeNil)
+		So(shapes, ShouldResemble, []Shape{&Square{2}})
+	})
+
+	Convey("should reject unregistered or unknown implementations", t, func() {
+		var d Drawing
+		err := r.DecodeInto([]byte(`{"Main": {"_struct_name": "reflectx.Triangle", "B": 1, "H": 2}}`), &d)
+		So(err.Error(), ShouldEqual, `reflectx: "reflectx.Triangle" is not a registered implementation of reflectx.Shape at /Main`)
+
+		err = r.DecodeInto([]byte(`{"Shapes": [{"_struct_name": "reflectx.Bar"}]}`), &d)
+		So(err.Error(), ShouldEqual, `reflectx: "reflectx.Bar" is not a registered implementation of reflectx.Shape at /Shapes/0`)
+
+		err = r.DecodeInto([]byte(`{"Shapes": [1]}`), &d)
+		So(err.Error(), ShouldEqual, "reflectx: type mismatch, expected reflectx.Shape, got json.Number at /Shapes/0")
+	})
+
+	Convey("should check implementations of unregistered interfaces", t, func() {
+		type Areas struct {
+			A []interface{ Area() float64 }
+		}
+		var a Areas
+		err := r.DecodeInto([]byte(`{"A": [{"_struct_name": "reflectx.Triangle", "B": 1, "H": 2}]}`), &a)
+		So(err, ShouldBeNil)
+		So(a.A[0], ShouldResemble, Triangle{1, 2})
+
+		err = r.DecodeInto([]byte(`{"A": [{"_struct_name": "reflectx.Drawing"}]}`), &a)
+		So(err.Error(), ShouldEqual, "reflectx: reflectx.Drawing does not implement interface { Area() float64 } at /A/0")
+	})
+
+	Convey("should panic if the type does not implement the interface", t, func() {
+		So(func() { r.RegisterInterface((*Shape)(nil), Bar{}) }, ShouldPanicWith, "reflectx.Bar does not implement reflectx.Shape")
+		So(func() { r.RegisterInterface(Shape(nil), Circle{}) }, ShouldPanic)
+	})
+}
+
+func TestNameStyles(t *testing.T) {
+	i := 1
+	s := "string"
+	bar := Bar{&i, &s}
+	f := Foo{
+		F: 1,
+		O: map[string]interface{}{
+			"string": "string",
+			"bar":    bar,
+		},
+	}
+	sf := []Foo{f, f}
+	psf := []*Foo{&f, nil, &f}
+	fb := FooBar{
+		Foo:    f,
+		Bar:    bar,
+		PBar:   &bar,
+		SFoo:   sf,
+		PSFoo:  &sf,
+		PSPFoo: &psf,
+	}
+
+	cases := []struct {
+		opts   []ReflectorOption
+		expect string
+	}{
+		{
+			[]ReflectorOption{WithNameKey("@type")},
+			`{"@type":"reflectx.Foo","O":{"bar":{"@type":"reflectx.Bar","Ar":"string","B":1}},"f":1}`,
+		},
+		{
+			[]ReflectorOption{WithEnvelope("type", "value")},
+			`{"type":"reflectx.Foo","value":{"O":{"bar":{"type":"reflectx.Bar","value":{"Ar":"string","B":1}}},"f":1}}`,
+		},
+		{
+			[]ReflectorOption{WithExternalTag()},
+			`{"reflectx.Foo":{"O":{"bar":{"reflectx.Bar":{"Ar":"string","B":1}}},"f":1}}`,
+		},
+		{
+			[]ReflectorOption{WithEnvelope("type", "value"), OmitStaticName()},
+			`{"type":"reflectx.Foo","value":{"O":{"bar":{"type":"reflectx.Bar","value":{"Ar":"string","B":1}}},"f":1}}`,
+		},
+		{
+			[]ReflectorOption{OmitStaticName()},
+			`{"O":{"bar":{"Ar":"string","B":1,"_struct_name":"reflectx.Bar"}},"_struct_name":"reflectx.Foo","f":1}`,
+		},
+	}
+
+	for _, c := range cases {
+		r := NewReflector("json", "", nil, c.opts...)
+		r.Register(Bar{})
+		r.Register(Foo{})
+		r.Register(FooBar{})
+
+		Convey("should mark struct name with style: "+c.expect, t, func() {
+			b, err := r.Encode(Foo{F: 1, O: map[string]interface{}{"bar": bar}})
+			So(err, ShouldBeNil)
+			So(string(b), ShouldEqual, c.expect)
+
+			b, err = r.Encode(fb)
+			So(err, ShouldBeNil)
+			rv, err := r.Decode(b)
+			So(err, ShouldBeNil)
+			So(rv, ShouldResemble, fb)
+
+			var sb []Bar
+			b, err = r.Encode(map[string]interface{}{"bars": []Bar{bar, bar}})
+			So(err, ShouldBeNil)
+			var mp map[string][]Bar
+			So(r.DecodeInto(b, &mp), ShouldBeNil)
+			So(mp["bars"], ShouldResemble, append(sb, bar, bar))
+		})
+	}
+
+	Convey("should omit the struct name of static types", t, func() {
+		r := NewReflector("json", "", nil, OmitStaticName())
+		b, err := r.Encode(FooBar{Foo: Foo{F: 1}, PBar: &bar, SFoo: []Foo{{F: 1}}})
+		So(err, ShouldBeNil)
+		So(string(b), ShouldEqual, `{"F":{"f":1},"PBar":{"Ar":"string","B":1},"SFoo":[{"f":1}],"_struct_name":"reflectx.FooBar"}`)
+	})
+}
+
+type Config struct {
+	Name string
+}
+
+type Node struct {
+	Name     string
+	Parent   *Node
+	Children []*Node
+	Config   *Config
+	Any      interface{}
+}
+
+func TestKeepReferences(t *testing.T) {
+	cfg := &Config{"shared"}
+	root := &Node{Name: "root", Config: cfg}
+	a := &Node{Name: "a", Parent: root, Config: cfg}
+	b := &Node{Name: "b", Parent: root, Config: cfg, Any: a}
+	root.Children = []*Node{a, b}
+	root.Any = root
+
+	for _, format := range []string{"json", "bson"} {
+		r := NewReflector(format, "", nil, KeepReferences())
+		r.Register(Node{})
+		r.Register(Config{})
+
+		Convey("should restore shared and cyclic pointers with "+format, t, func() {
+			data, err := r.Encode(root)
+			So(err, ShouldBeNil)
+
+			rv, err := r.Decode(data)
+			So(err, ShouldBeNil)
+			n, ok := rv.(*Node)
+			So(ok, ShouldBeTrue)
+			checkNodes(n)
+
+			n = nil
+			So(r.DecodeInto(data, &n), ShouldBeNil)
+			checkNodes(n)
+
+			var v Node
+			So(r.DecodeInto(data, &v), ShouldBeNil)
+			So(v.Children[0].Parent == &v, ShouldBeTrue)
+			checkNodes(&v)
+		})
+	}
+
+	Convey("should keep the names of values with ids if static names are omitted", t, func() {
+		r := NewReflector("json", "", nil, KeepReferences(), OmitStaticName())
+		r.Register(Node{})
+		r.Register(Config{})
+		data, err := r.Encode(root)
+		So(err, ShouldBeNil)
+		So(string(data), ShouldEqual, `{"$id":1,"Any":{"$ref":1},"Children":[`+
+			`{"$id":2,"Config":{"$id":3,"Name":"shared","_struct_name":"reflectx.Config"},"Name":"a","Parent":{"$ref":1},"_struct_name":"reflectx.Node"},`+
+			`{"$id":4,"Any":{"$ref":2},"Config":{"$ref":3},"Name":"b","Parent":{"$ref":1},"_struct_name":"reflectx.Node"}],`+
+			`"Config":{"$ref":3},"Name":"root","_struct_name":"reflectx.Node"}`)
+
+		// the references in interface{} fields may be decoded first.
+		for i := 0; i < 50; i++ {
+			var n *Node
+			So(r.DecodeInto(data, &n), ShouldBeNil)
+			checkNodes(n)
+		}
+	})
+
+	r := NewReflector("json", "", nil, KeepReferences())
+	r.Register(Node{})
+
+	Convey("should encode repeated pointers as references", t, func() {
+		data, err := r.Encode(map[string]interface{}{"a": cfg, "b": []*Config{cfg, cfg}})
+		So(err, ShouldBeNil)
+		So(string(data), ShouldEqual, `{"a":{"$id":1,"Name":"shared","_struct_name":"reflectx.Config"},"b":[{"$ref":1},{"$ref":1}]}`)
+	})
+
+	Convey("should decode references before the values they refer to", t, func() {
+		var n Node
+		err := r.DecodeInto([]byte(`{"Children": [{"$ref": 2}, {"$id": 2, "Name": "a", "Parent": {"$ref": 1}}], "$id": 1, "Name": "root", "Parent": {"$ref": 2}}`), &n)
+		So(err, ShouldBeNil)
+		So(n.Children[0], ShouldEqual, n.Children[1])
+		So(n.Children[0].Parent == &n, ShouldBeTrue)
+		So(n.Parent, ShouldEqual, n.Children[0])
+		So(n.Parent.Parent.Parent, ShouldEqual, n.Parent)
+	})
+
+	Convey("should return error for unknown reference", t, func() {
+		var n Node
+		err := r.DecodeInto([]byte(`{"Parent": {"$ref": 3}}`), &n)
+		So(err.Error(), ShouldEqual, "reflectx: unknown reference id 3 at /Parent")
 	})
 }
+
+func checkNodes(n *Node) {
+	So(n.Name, ShouldEqual, "root")
+	So(n.Any, ShouldEqual, n)
+	So(n.Children, ShouldHaveLength, 2)
+	a, b := n.Children[0], n.Children[1]
+	So(a.Name, ShouldEqual, "a")
+	So(b.Name, ShouldEqual, "b")
+	So(a.Parent, ShouldEqual, n)
+	So(b.Parent, ShouldEqual, n)
+	So(b.Any, ShouldEqual, a)
+	So(n.Config.Name, ShouldEqual, "shared")
+	So(a.Config, ShouldEqual, n.Config)
+	So(b.Config, ShouldEqual, n.Config)
+}
+
+type Profile struct {
+	Name  string
+	Extra map[string]interface{} `reflector:",remain"`
+}
+
+func TestUnknownFields(t *testing.T) {
+	// the payload of a newer producer.
+	newer := map[string]interface{}{"Name": "a", "Age": 3, "Tags": []string{"x"}}
+
+	type Account struct {
+		Name string
+	}
+
+	Convey("should return error for unknown fields by default", t, func() {
+		r := NewReflector("json", "", nil)
+		data, err := r.Encode(newer)
+		So(err, ShouldBeNil)
+
+		var a Account
+		err = r.DecodeInto(data, &a)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "is not a path in struct reflectx.Account")
+	})
+
+	Convey("should decode the remain keys it encodes by default", t, func() {
+		r := NewReflector("json", "", nil)
+		r.Register(Profile{})
+		p := Profile{Name: "a", Extra: map[string]interface{}{"zz": "x"}}
+		data, err := r.Encode(p)
+		So(err, ShouldBeNil)
+		So(string(data), ShouldEqual, `{"Name":"a","_struct_name":"reflectx.Profile","zz":"x"}`)
+
+		var p2 Profile
+		So(r.DecodeInto(data, &p2), ShouldBeNil)
+		So(p2, ShouldResemble, p)
+		rv, err := r.Decode(data)
+		So(err, ShouldBeNil)
+		So(rv, ShouldResemble, p)
+	})
+
+	for _, format := range []string{"json", "bson"} {
+		Convey("should ignore unknown fields with "+format, t, func() {
+			r := NewReflector(format, "", nil, WithUnknownFields(IgnoreUnknownFields))
+			data, err := r.Encode(newer)
+			So(err, ShouldBeNil)
+
+			var a Account
+			So(r.DecodeInto(data, &a), ShouldBeNil)
+			So(a, ShouldResemble, Account{Name: "a"})
+
+			// the remain field collects them whatever the policy is.
+			var p Profile
+			So(r.DecodeInto(data, &p), ShouldBeNil)
+			So(p.Extra, ShouldContainKey, "Age")
+		})
+
+		Convey("should collect unknown fields with "+format, t, func() {
+			r := NewReflector(format, "", nil, WithUnknownFields(CollectUnknownFields), OmitStaticName())
+			r.Register(Profile{})
+			data, err := r.Encode(newer)
+			So(err, ShouldBeNil)
+
+			var p Profile
+			So(r.DecodeInto(data, &p), ShouldBeNil)
+			So(p.Name, ShouldEqual, "a")
+			So(p.Extra, ShouldContainKey, "Age")
+			So(p.Extra["Tags"], ShouldResemble, []interface{}{"x"})
+
+			// the remain keys are encoded into the parent level.
+			data, err = r.Encode(p)
+			So(err, ShouldBeNil)
+			var p2 Profile
+			So(r.DecodeInto(data, &p2), ShouldBeNil)
+			So(p2, ShouldResemble, p)
+		})
+	}
+
+	Convey("should not override fields by remain keys", t, func() {
+		r := NewReflector("json", "", nil, WithUnknownFields(CollectUnknownFields))
+		data, err := r.Encode(Profile{Name: "a", Extra: map[string]interface{}{"Name": "b", "Age": 1}})
+		So(err, ShouldBeNil)
+		So(string(data), ShouldEqual, `{"Age":1,"Name":"a","_struct_name":"reflectx.Profile"}`)
+	})
+}
+
+type Item struct {
+	Name  string
+	Count int
+}
+
+type Cart struct {
+	Items []Item
+	Notes map[string]int
+	Owner *Bar
+}
+
+func TestDecodeErrors(t *testing.T) {
+	r := NewReflector("json", "", nil)
+	r.Register(Cart{})
+
+	Convey("should return the path of the error", t, func() {
+		var c Cart
+		err := r.DecodeInto([]byte(`{"Items": [{"Name": "a"}, {"Count": "x"}]}`), &c)
+		de, ok := err.(*DecodeError)
+		So(ok, ShouldBeTrue)
+		So(de.Path, ShouldEqual, "/Items/1/Count")
+		So(de.Expected, ShouldEqual, reflect.TypeOf(0))
+		So(de.Got, ShouldEqual, reflect.TypeOf(""))
+		So(de.Value, ShouldEqual, "x")
+		So(errors.Unwrap(err), ShouldNotBeNil)
+
+		err = r.DecodeInto([]byte(`{"Notes": {"a/b~c": true}}`), &c)
+		So(err.(*DecodeError).Path, ShouldEqual, "/Notes/a~1b~0c")
+
+		err = r.DecodeInto([]byte(`{"Owner": {"C": 1}}`), &c)
+		So(err.Error(), ShouldEqual, "reflectx: C is not a path in struct reflectx.Bar at /Owner/C")
+
+		_, err = r.Decode([]byte(`{"_struct_name": "reflectx.Cart", "Items": [{"Count": true}]}`))
+		So(err.(*DecodeError).Path, ShouldEqual, "/Items/0/Count")
+	})
+
+	Convey("should return the path in the wrappers of struct names", t, func() {
+		r := NewReflector("json", "", nil, WithEnvelope("type", "value"))
+		r.Register(Cart{})
+		r.Register(Bar{})
+		data := []byte(`{"type": "reflectx.Cart", "value": {"Items": [{"Count": "x"}]}}`)
+		_, err := r.Decode(data)
+		So(err.(*DecodeError).Path, ShouldEqual, "/value/Items/0/Count")
+		var c Cart
+		err = r.DecodeInto(data, &c)
+		So(err.(*DecodeError).Path, ShouldEqual, "/value/Items/0/Count")
+		err = r.DecodeInto([]byte(`{"type": "reflectx.Cart", "value": {"Owner": {"type": "reflectx.Bar", "value": {"C": 1}}}}`), &c)
+		So(err.(*DecodeError).Path, ShouldEqual, "/value/Owner/value/C")
+		var v struct{ Any interface{} }
+		err = r.DecodeInto([]byte(`{"Any": {"type": "reflectx.Bar", "value": {"C": 1}}}`), &v)
+		So(err.(*DecodeError).Path, ShouldEqual, "/Any/value/C")
+
+		r = NewReflector("json", "", nil, WithExternalTag())
+		r.Register(Cart{})
+		r.Register(Bar{})
+		_, err = r.Decode([]byte(`{"reflectx.Cart": {"Owner": {"reflectx.Bar": {"C": 1}}}}`))
+		So(err.(*DecodeError).Path, ShouldEqual, "/reflectx.Cart/Owner/reflectx.Bar/C")
+	})
+
+	Convey("should collect all errors", t, func() {
+		r := NewReflector("json", "", nil, CollectErrors())
+		var c Cart
+		err := r.DecodeInto([]byte(`{"Items": [{"Name": "a", "Count": "x"}, {"Name": "b"}], "Notes": {"n": 1, "m": "y"}, "X": 1}`), &c)
+		es, ok := err.(DecodeErrors)
+		So(ok, ShouldBeTrue)
+		So(len(es), ShouldEqual, 3)
+		So(es[0].Path, ShouldEqual, "/Items/0/Count")
+		So(es[1].Path, ShouldEqual, "/Notes/m")
+		So(es[2].Path, ShouldEqual, "/X")
+
+		// the errors are in the same order whatever the order of decoding is.
+		data := []byte(`{"Notes": {"a": "x", "b": "x", "c": "x", "d": "x", "e": "x", "f": "x"}, "Y": 1, "X": 1}`)
+		var c2 Cart
+		msg := r.DecodeInto(data, &c2).Error()
+		for i := 0; i < 20; i++ {
+			So(r.DecodeInto(data, &c2).Error(), ShouldEqual, msg)
+		}
+
+		// the valid values are decoded.
+		So(c.Items[1].Name, ShouldEqual, "b")
+		So(c.Notes["n"], ShouldEqual, 1)
+
+		So(r.DecodeInto([]byte(`{"Items": [{"Name": "a"}]}`), &c), ShouldBeNil)
+	})
+}
+
+func TestDecodeLimits(t *testing.T) {
+	r := NewReflector("json", "", nil)
+	r.Register(Cart{})
+	r.Register(Bar{})
+	data := []byte(`{"_struct_name": "reflectx.Cart", "Items": [{"Name": "abcdef"}, {"Name": "b"}], "Notes": {"n": 1}}`)
+
+	Convey("should decode within limits", t, func() {
+		_, err := r.With(WithMaxDepth(3), WithMaxElements(8), WithMaxLength(13)).Decode(data)
+		So(err, ShouldBeNil)
+	})
+
+	Convey("should return LimitError", t, func() {
+		var le *LimitError
+		_, err := r.With(WithMaxDepth(2)).Decode(data)
+		So(errors.As(err, &le), ShouldBeTrue)
+		So(*le, ShouldResemble, LimitError{"depth", 2})
+		So(err.(*DecodeError).Path, ShouldStartWith, "/Items/")
+
+		var c Cart
+		err = r.With(WithMaxElements(7)).DecodeInto(data, &c)
+		So(errors.As(err, &le), ShouldBeTrue)
+		So(*le, ShouldResemble, LimitError{"elements", 7})
+
+		// limits are not collected by CollectErrors.
+		err = r.With(WithMaxLength(5), CollectErrors()).DecodeInto([]byte(`{"Items": [{"Name": "abcdef"}]}`), &c)
+		So(err.Error(), ShouldEqual, "reflectx: exceeded max length 5 at /Items/0/Name")
+		err = r.With(WithMaxLength(5)).DecodeInto([]byte(`{"Notes": {"n": 1234567890}}`), &c)
+		So(err.Error(), ShouldEqual, "reflectx: exceeded max length 5 at /Notes/n")
+	})
+
+	Convey("should only decode allowed types", t, func() {
+		_, err := r.With(AllowTypes("reflectx.Bar")).Decode(data)
+		var ne *NotAllowedError
+		So(errors.As(err, &ne), ShouldBeTrue)
+		So(ne.Name, ShouldEqual, "reflectx.Cart")
+
+		_, err = r.With(AllowTypes("reflectx.Cart")).Decode(data)
+		So(err, ShouldBeNil)
+
+		var v struct{ Any interface{} }
+		err = r.With(AllowTypes("reflectx.Cart")).DecodeInto([]byte(`{"Any": {"_struct_name": "reflectx.Bar"}}`), &v)
+		So(err.Error(), ShouldEqual, `reflectx: type "reflectx.Bar" is not allowed at /Any`)
+
+		// r is not changed by With.
+		So(r.DecodeInto([]byte(`{"Any": {"_struct_name": "reflectx.Bar"}}`), &v), ShouldBeNil)
+	})
+}
+
+type Options struct {
+	Count   int    `reflector:",omitempty"`
+	Name    string `reflector:",omitempty"`
+	Level   int
+	Since   time.Time `reflector:",omitzero"`
+	Bar     Bar       `reflector:",omitzero"`
+	Ptr     *int      `reflector:",omitempty"`
+	Tags    []string  `reflector:",omitempty"`
+	List    []int
+	Attrs   map[string]*Bar
+	Nothing map[string]string
+}
+
+func TestOmitEmpty(t *testing.T) {
+	Convey("should omit empty and zero fields", t, func() {
+		r := NewReflector("json", "", nil, OmitStaticName())
+		zero := 0
+		b, err := r.Encode(Options{Ptr: &zero, Tags: []string{}, List: []int{}, Attrs: map[string]*Bar{"a": nil}})
+		So(err, ShouldBeNil)
+		So(string(b), ShouldEqual, `{"Level":0,"Ptr":0,"_struct_name":"reflectx.Options"}`)
+
+		b, err = r.Encode(Options{Count: 1, Since: time.Unix(0, 0).UTC(), Bar: Bar{B: &zero}})
+		So(err, ShouldBeNil)
+		So(string(b), ShouldEqual, `{"Bar":{"B":0},"Count":1,"Level":0,"Since":"1970-01-01T00:00:00Z","_struct_name":"reflectx.Options"}`)
+	})
+
+	Convey("should keep empty collections and nil elements", t, func() {
+		r := NewReflector("json", "", nil, OmitStaticName(), KeepEmptyCollections(), KeepNilElements())
+		r.Register(Options{})
+		b, err := r.Encode(Options{Tags: []string{}, List: []int{}, Attrs: map[string]*Bar{"a": nil}})
+		So(err, ShouldBeNil)
+		So(string(b), ShouldEqual, `{"Attrs":{"a":null},"Level":0,"List":[],"_struct_name":"reflectx.Options"}`)
+
+		var o Options
+		So(r.DecodeInto(b, &o), ShouldBeNil)
+		So(o.List, ShouldNotBeNil)
+		So(o.List, ShouldBeEmpty)
+		So(o.Nothing, ShouldBeNil)
+		So(o.Attrs, ShouldResemble, map[string]*Bar{"a": nil})
+	})
+}
+
+type Cell struct {
+	Row, Col int
+}
+
+type Sheet struct {
+	Counts map[int]int
+	Flags  map[bool]string
+	Levels map[Level]float64
+	Cells  map[Cell]string
+	Pairs  map[[2]int]*Bar
+}
+
+func TestMapKeys(t *testing.T) {
+	i := 1
+	sheet := Sheet{
+		Counts: map[int]int{-1: 1, 10: 2},
+		Flags:  map[bool]string{true: "yes", false: "no"},
+		Levels: map[Level]float64{2: 0.5},
+		Cells:  map[Cell]string{{1, 2}: "a", {3, 4}: "b"},
+		Pairs:  map[[2]int]*Bar{{1, 2}: {B: &i}},
+	}
+
+	Convey("should stringify the keys of map", t, func() {
+		r := NewReflector("json", "", nil, OmitStaticName())
+		b, err := r.Encode(sheet)
+		So(err, ShouldBeNil)
+		So(string(b), ShouldEqual, `{"Cells":{"{\"Col\":2,\"Row\":1}":"a","{\"Col\":4,\"Row\":3}":"b"},`+
+			`"Counts":{"-1":1,"10":2},"Flags":{"false":"no","true":"yes"},"Levels":{"**":0.5},`+
+			`"Pairs":{"[1,2]":{"B":1}},"_struct_name":"reflectx.Sheet"}`)
+	})
+
+	for _, format := range []string{"json", "bson"} {
+		Convey("should restore the keys of map with "+format, t, func() {
+			r := NewReflector(format, "", nil)
+			b, err := r.Encode(sheet)
+			So(err, ShouldBeNil)
+
+			var v Sheet
+			So(r.DecodeInto(b, &v), ShouldBeNil)
+			So(v, ShouldResemble, sheet)
+
+			rv, err := r.Decode(b)
+			So(err, ShouldBeNil)
+			So(rv, ShouldResemble, sheet)
+		})
+	}
+}
+
+func newBenchReflector(format string) (Reflector, []byte) {
+	r := NewReflector(format, "", nil)
+	// register some other types, NameMap should not be slowed down by them.
+	r.Register(All{})
+	r.Register(FooStruct{})
+	r.Register(FooBarStruct{})
+	r.Register(third{})
+	r.Register(Bar{})
+	r.Register(Foo{})
+	r.Register(FooBar{})
+	r.Register(struct{}{})
+
+	i := 1
+	s := "string"
+	bar := Bar{&i, &s}
+	f := Foo{
+		F: 1,
+		O: map[string]interface{}{
+			"struct": struct{}{},
+			"bar":    bar,
+		},
+	}
+	sf := []Foo{f, f, f, f}
+	psf := []*Foo{&f, nil, &f}
+	b, err := r.Encode(FooBar{
+		Foo:    f,
+		Bar:    bar,
+		PBar:   &bar,
+		SFoo:   sf,
+		PSFoo:  &sf,
+		PSPFoo: &psf,
+	})
+	if err != nil {
+		panic(err)
+	}
+	return r, b
+}
+
+func Benchmark_ReflectorDecodeJson(b *testing.B) {
+	r, data := newBenchReflector("json")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := r.Decode(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func Benchmark_ReflectorDecodeBson(b *testing.B) {
+	r, data := newBenchReflector("bson")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := r.Decode(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package reflectx
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// maxBSONSize is the maximum size of a bson document read by Decoder.
+const maxBSONSize = 16 * 1024 * 1024
+
+// An Encoder writes a sequence of values encoded by a Reflector to an output stream.
+// Values of json format are separated by newlines(NDJSON),
+// values of bson format are written as concatenated documents.
+type Encoder struct {
+	r reflector
+	w io.Writer
+}
+
+// NewEncoder returns a new encoder that writes to w.
+func (r reflector) NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{r, w}
+}
+
+// Encode writes the encoding of v to the stream,
+// v can be a struct or map[string]interface{}, the same as Reflector.Encode.
+func (e *Encoder) Encode(v interface{}) error {
+	b, err := e.r.Encode(v)
+	if err != nil {
+		return err
+	}
+	if e.r.format != "bson" {
+		b = append(b, '\n')
+	}
+	_, err = e.w.Write(b)
+	return err
+}
+
+// A Decoder reads and decodes a sequence of values written by Encoder from an input stream.
+// Only one value is kept in memory at a time.
+type Decoder struct {
+	r reflector
+	// next reads the next value of the stream to v.
+	next func(v interface{}) error
+}
+
+// NewDecoder returns a new decoder that reads from rd.
+func (r reflector) NewDecoder(rd io.Reader) *Decoder {
+	d := &Decoder{r: r}
+	if r.format == "bson" {
+		d.next = bsonReader(rd)
+	} else {
+		jd := json.NewDecoder(rd)
+		jd.UseNumber()
+		d.next = jd.Decode
+	}
+	return d
+}
+
+// Decode reads the next value from the stream, the same as Reflector.Decode.
+// It returns io.EOF at the end of the stream.
+func (d *Decoder) Decode() (interface{}, error) {
+	var mp map[string]interface{}
+	if err := d.next(&mp); err != nil {
+		return nil, err
+	}
+	ds, err := newDecodeState(d.r, mp)
+	if err != nil {
+		return nil, err
+	}
+	rv, err := ds.decode(mp)
+	return rv, d.r.validate(reflect.ValueOf(rv), ds.result(err))
+}
+
+// DecodeInto reads the next value from the stream to ptr, the same as Reflector.DecodeInto.
+// It returns io.EOF at the end of the stream.
+func (d *Decoder) DecodeInto(ptr interface{}) error {
+	return d.r.decodeFrom(d.next, ptr)
+}
+
+// bsonReader returns a function to read concatenated bson documents from rd.
+func bsonReader(rd io.Reader) func(v interface{}) error {
+	return func(v interface{}) error {
+		// the first 4 bytes of a document is the total size of it.
+		var head [4]byte
+		if _, err := io.ReadFull(rd, head[:]); err != nil {
+			return err
+		}
+		size := binary.LittleEndian.Uint32(head[:])
+		if size < 5 || size > maxBSONSize {
+			return fmt.Errorf("reflectx: invalid bson document size %d", size)
+		}
+
+		doc := make([]byte, size)
+		copy(doc, head[:])
+		if _, err := io.ReadFull(rd, doc[4:]); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		return bson.Unmarshal(doc, v)
+	}
+}
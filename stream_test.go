@@ -0,0 +1,95 @@
+package reflectx
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestStream(t *testing.T) {
+	i := 1
+	s := "string"
+	bar := Bar{&i, &s}
+	records := []interface{}{
+		bar,
+		Foo{F: 1, O: map[string]interface{}{"bar": bar}},
+		&Circle{2},
+		map[string]interface{}{"bar": bar, "string": "string"},
+	}
+	expect := []interface{}{
+		bar,
+		Foo{F: 1, O: map[string]interface{}{"bar": bar}},
+		Circle{2},
+		map[string]interface{}{"bar": bar, "string": "string"},
+	}
+
+	for _, format := range []string{"json", "indentedjson", "bson"} {
+		r := NewReflector(format, "", nil)
+		r.Register(Bar{})
+		r.Register(Foo{})
+		r.Register(Circle{})
+
+		Convey("should encode and decode a sequence of values with "+format, t, func() {
+			buf := &bytes.Buffer{}
+			enc := r.NewEncoder(buf)
+			for _, v := range records {
+				So(enc.Encode(v), ShouldBeNil)
+			}
+
+			dec := r.NewDecoder(buf)
+			for _, v := range expect {
+				rv, err := dec.Decode()
+				So(err, ShouldBeNil)
+				So(rv, ShouldResemble, v)
+			}
+			_, err := dec.Decode()
+			So(err, ShouldEqual, io.EOF)
+		})
+
+		Convey("should decode a sequence of values into typed targets with "+format, t, func() {
+			buf := &bytes.Buffer{}
+			enc := r.NewEncoder(buf)
+			So(enc.Encode(bar), ShouldBeNil)
+			So(enc.Encode(&bar), ShouldBeNil)
+
+			dec := r.NewDecoder(buf)
+			var rb Bar
+			So(dec.DecodeInto(&rb), ShouldBeNil)
+			So(rb, ShouldResemble, bar)
+			var prb *Bar
+			So(dec.DecodeInto(&prb), ShouldBeNil)
+			So(prb, ShouldResemble, &bar)
+			So(dec.DecodeInto(&rb), ShouldEqual, io.EOF)
+		})
+	}
+
+	Convey("should decode NDJSON", t, func() {
+		r := NewReflector("json", "", nil)
+		r.Register(Bar{})
+		dec := r.NewDecoder(bytes.NewBufferString(`{"_struct_name": "reflectx.Bar", "B": 1, "Ar": "string"}
+{"B": 1}
+`))
+		rv, err := dec.Decode()
+		So(err, ShouldBeNil)
+		So(rv, ShouldResemble, bar)
+
+		var rb Bar
+		So(dec.DecodeInto(&rb), ShouldBeNil)
+		So(*rb.B, ShouldEqual, 1)
+		So(rb.Ar, ShouldBeNil)
+	})
+
+	Convey("should return errors for truncated or invalid bson", t, func() {
+		r := NewReflector("bson", "", nil)
+		b, err := r.Encode(bar)
+		So(err, ShouldBeNil)
+
+		_, err = r.NewDecoder(bytes.NewReader(b[:len(b)-1])).Decode()
+		So(err, ShouldEqual, io.ErrUnexpectedEOF)
+
+		_, err = r.NewDecoder(bytes.NewReader([]byte{0xff, 0xff, 0xff, 0xff})).Decode()
+		So(err.Error(), ShouldEqual, "reflectx: invalid bson document size 4294967295")
+	})
+}
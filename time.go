@@ -0,0 +1,245 @@
+package reflectx
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// the options of form and default tags to convert time.Time, they are parsed
+// when the struct is mapped:
+//	layout=l   the layout of time.Format, or one of the names in timeLayouts
+//	unix       the seconds since the Unix epoch
+//	unixmilli  the milliseconds since the Unix epoch
+//	unixmicro  the microseconds since the Unix epoch
+//	unixnano   the nanoseconds since the Unix epoch
+//	loc=name   the time zone of time.LoadLocation, such as "UTC" or "Asia/Shanghai"
+// Without the options, time.Time is converted by RFC3339 with nanoseconds.
+// The options are ignored for the fields other than time.Time, *time.Time
+// and the slices, arrays or maps of them.
+// The layout containing ',' can not be written in tags, use the name instead.
+// For example:
+//	Since time.Time  `form:"since,layout=2006-01-02,loc=Asia/Shanghai"`
+//	Until time.Time  `form:"until,unixmilli"`
+//	Day   *time.Time `form:"day,layout=DateOnly"`
+const (
+	optLayout    = "layout"
+	optUnix      = "unix"
+	optUnixMilli = "unixmilli"
+	optUnixMicro = "unixmicro"
+	optUnixNano  = "unixnano"
+	optLoc       = "loc"
+)
+
+// timeLayouts are the names of layouts for the "layout" option.
+var timeLayouts = map[string]string{
+	"ANSIC":       time.ANSIC,
+	"UnixDate":    time.UnixDate,
+	"RubyDate":    time.RubyDate,
+	"RFC822":      time.RFC822,
+	"RFC822Z":     time.RFC822Z,
+	"RFC850":      time.RFC850,
+	"RFC1123":     time.RFC1123,
+	"RFC1123Z":    time.RFC1123Z,
+	"RFC3339":     time.RFC3339,
+	"RFC3339Nano": time.RFC3339Nano,
+	"Kitchen":     time.Kitchen,
+	"Stamp":       time.Stamp,
+	"StampMilli":  time.StampMilli,
+	"StampMicro":  time.StampMicro,
+	"StampNano":   time.StampNano,
+	"DateTime":    "2006-01-02 15:04:05",
+	"DateOnly":    "2006-01-02",
+	"TimeOnly":    "15:04:05",
+}
+
+// timeFormat converts time.Time by a layout or a unit since the Unix epoch.
+type timeFormat struct {
+	layout string
+	// unit is not zero if time.Time is converted to an integer.
+	unit time.Duration
+	// loc is the location of parsing and formatting, nil means UTC for
+	// the units and the zone in the string for the layout.
+	loc *time.Location
+}
+
+var defaultTimeFormat = timeFormat{layout: time.RFC3339Nano}
+
+// newTimeFormat returns the timeFormat by the options of fi, ok is false
+// if there is no time option. It panics if the options are invalid.
+func newTimeFormat(fi *FieldInfo) (tf timeFormat, ok bool) {
+	tf = defaultTimeFormat
+	if layout, has := fi.Options[optLayout]; has {
+		if named, found := timeLayouts[layout]; found {
+			layout = named
+		}
+		if layout == "" {
+			panic("reflectx: empty layout option of " + fi.Path)
+		}
+		tf.layout, ok = layout, true
+	}
+	for opt, unit := range map[string]time.Duration{
+		optUnix:      time.Second,
+		optUnixMilli: time.Millisecond,
+		optUnixMicro: time.Microsecond,
+		optUnixNano:  time.Nanosecond,
+	} {
+		if _, has := fi.Options[opt]; has {
+			if _, layout := fi.Options[optLayout]; layout || tf.unit != 0 {
+				panic("reflectx: conflicting time options of " + fi.Path)
+			}
+			tf.unit, ok = unit, true
+		}
+	}
+	if name, has := fi.Options[optLoc]; has {
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			panic("reflectx: invalid loc option of " + fi.Path + ": " + err.Error())
+		}
+		tf.loc, ok = loc, true
+	}
+	return tf, ok
+}
+
+// parse returns the time represented by s.
+func (tf timeFormat) parse(s string) (time.Time, error) {
+	if tf.unit == 0 {
+		if tf.loc != nil {
+			return time.ParseInLocation(tf.layout, s, tf.loc)
+		}
+		return time.Parse(tf.layout, s)
+	}
+
+	n, err := parseInt(s, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	perSec := int64(time.Second / tf.unit)
+	t := time.Unix(n/perSec, n%perSec*int64(tf.unit))
+	if tf.loc != nil {
+		return t.In(tf.loc), nil
+	}
+	return t.UTC(), nil
+}
+
+// format returns the string of t.
+func (tf timeFormat) format(t time.Time) string {
+	if tf.unit == 0 {
+		if tf.loc != nil {
+			t = t.In(tf.loc)
+		}
+		return t.Format(tf.layout)
+	}
+	perSec := int64(time.Second / tf.unit)
+	return strconv.FormatInt(t.Unix()*perSec+int64(t.Nanosecond())/int64(tf.unit), 10)
+}
+
+func (tf timeFormat) encode(v reflect.Value) (string, error) {
+	return tf.format(v.Interface().(time.Time)), nil
+}
+
+func (tf timeFormat) decode(s string, v reflect.Value) error {
+	t, err := tf.parse(s)
+	if err == nil {
+		v.Set(reflect.ValueOf(t))
+	}
+	return err
+}
+
+// registerTimeConverters registers the built-in converters of time.Time
+// and time.Duration to cs.
+func registerTimeConverters(cs *converters) {
+	cs.m.Store(timeType, converter{defaultTimeFormat.encode, defaultTimeFormat.decode, true})
+	cs.m.Store(durationType, converter{
+		func(v reflect.Value) (string, error) {
+			return time.Duration(v.Int()).String(), nil
+		},
+		func(s string, v reflect.Value) error {
+			d, err := parseDuration(s)
+			if err == nil {
+				v.SetInt(int64(d))
+			}
+			return err
+		},
+		true,
+	})
+}
+
+// parseDuration parses s by time.ParseDuration, an integer without unit is
+// nanoseconds.
+func parseDuration(s string) (time.Duration, error) {
+	d, err := time.ParseDuration(s)
+	if err == nil {
+		return d, nil
+	}
+	if n, nerr := parseInt(s, 64); nerr == nil {
+		return time.Duration(n), nil
+	}
+	return 0, err
+}
+
+// setTime sets the time.Time field by the number v, which is the seconds
+// since the Unix epoch.
+func setTime(field, v reflect.Value) error {
+	var t time.Time
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		t = time.Unix(v.Int(), 0)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if v.Uint() > math.MaxInt64 {
+			return fmt.Errorf("reflectx: %d overflows %v", v.Uint(), field.Type())
+		}
+		t = time.Unix(int64(v.Uint()), 0)
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return errors.New("reflectx: invalid seconds for time.Time: " + strconv.FormatFloat(f, 'g', -1, 64))
+		}
+		sec, frac := math.Modf(f)
+		t = time.Unix(int64(sec), int64(math.Round(frac*1e9)))
+	default:
+		return fmt.Errorf("reflectx: type mismatch, expected %v, got %v", field.Type(), v.Type())
+	}
+	field.Set(reflect.ValueOf(t.UTC()))
+	return nil
+}
+
+// setTimeOptions sets the converters of fi by the time options, cs is the
+// parent of them. The options are ignored unless the type of fi is time.Time
+// or the elements of it are. It panics if the options are invalid.
+func setTimeOptions(fi *FieldInfo, cs *converters) {
+	if !isTimeType(fi.Type) {
+		return
+	}
+	if tf, ok := newTimeFormat(fi); ok {
+		fi.convs = &converters{parent: cs}
+		fi.convs.register(timeType, tf.encode, tf.decode)
+	}
+}
+
+// isTimeType returns whether t is time.Time, or the pointers, slices, arrays
+// or maps of it.
+func isTimeType(t reflect.Type) bool {
+	for {
+		switch t.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+			t = t.Elem()
+		default:
+			return t == timeType
+		}
+	}
+}
+
+// fieldConverters returns the converters of fi with the time options, or cs
+// if fi is nil or has no time option.
+func fieldConverters(fi *FieldInfo, cs *converters) *converters {
+	if fi == nil || fi.convs == nil {
+		return cs
+	}
+	return fi.convs
+}
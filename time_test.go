@@ -0,0 +1,221 @@
+package reflectx
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type Schedule struct {
+	Start    time.Time            `form:"start"`
+	Day      *time.Time           `form:"day,layout=DateOnly"`
+	Local    time.Time            `form:"local,layout=2006-01-02 15:04,loc=Asia/Shanghai"`
+	Until    time.Time            `form:"until,unixmilli"`
+	Stamp    time.Time            `form:"stamp,unix"`
+	Holidays []time.Time          `form:"holidays,split,layout=DateOnly"`
+	Slots    map[string]time.Time `form:"slots,layout=15:04"`
+	Timeout  time.Duration        `form:"timeout"`
+	Retries  []time.Duration      `form:"retries"`
+}
+
+func TestTimeForm(t *testing.T) {
+	fm := NewFormMapper("", nil)
+	var s Schedule
+	form := map[string][]string{
+		"start":       {"2024-03-01T08:30:00.5+08:00"},
+		"day":         {"2024-03-02"},
+		"local":       {"2024-03-03 09:15"},
+		"until":       {"1709251200123"},
+		"stamp":       {"1709251200"},
+		"holidays":    {"2024-05-01,2024-10-01"},
+		"slots[noon]": {"12:00"},
+		"timeout":     {"1m30s"},
+		"retries":     {"100ms", "2s", "5000"},
+	}
+	assert.Nil(t, fm.FormToStruct(form, &s))
+
+	shanghai, err := time.LoadLocation("Asia/Shanghai")
+	assert.Nil(t, err)
+	assert.True(t, s.Start.Equal(time.Date(2024, 3, 1, 0, 30, 0, 5e8, time.UTC)))
+	assert.Equal(t, time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC), *s.Day)
+	assert.Equal(t, time.Date(2024, 3, 3, 9, 15, 0, 0, shanghai), s.Local)
+	assert.Equal(t, time.Date(2024, 3, 1, 0, 0, 0, 123e6, time.UTC), s.Until)
+	assert.Equal(t, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), s.Stamp)
+	assert.Equal(t, []time.Time{time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 10, 1, 0, 0, 0, 0, time.UTC)}, s.Holidays)
+	assert.Equal(t, time.Date(0, 1, 1, 12, 0, 0, 0, time.UTC), s.Slots["noon"])
+	assert.Equal(t, 90*time.Second, s.Timeout)
+	assert.Equal(t, []time.Duration{100 * time.Millisecond, 2 * time.Second, 5000}, s.Retries)
+
+	// StructToForm formats by the same options.
+	out := map[string][]string{}
+	fm.StructToForm(s, out)
+	assert.Equal(t, []string{"2024-03-01T08:30:00.5+08:00"}, out["start"])
+	assert.Equal(t, []string{"2024-03-02"}, out["day"])
+	assert.Equal(t, []string{"2024-03-03 09:15"}, out["local"])
+	assert.Equal(t, []string{"1709251200123"}, out["until"])
+	assert.Equal(t, []string{"1709251200"}, out["stamp"])
+	assert.Equal(t, []string{"2024-05-01,2024-10-01"}, out["holidays"])
+	assert.Equal(t, []string{"12:00"}, out["slots[noon]"])
+	assert.Equal(t, []string{"1m30s"}, out["timeout"])
+	assert.Equal(t, []string{"100ms", "2s", "5µs"}, out["retries"])
+
+	var back Schedule
+	assert.Nil(t, fm.FormToStruct(out, &back))
+	assert.True(t, s.Start.Equal(back.Start))
+	assert.Equal(t, s.Until, back.Until)
+	assert.Equal(t, s.Retries, back.Retries)
+
+	// the errors are reported by keys.
+	err = fm.FormToStruct(map[string][]string{"day": {"03/02/2024"}, "timeout": {"soon"}}, &Schedule{})
+	errs, ok := err.(BindErrors)
+	assert.True(t, ok)
+	assert.Len(t, errs, 2)
+	assert.Equal(t, "day", errs[0].Key)
+	assert.Equal(t, reflect.TypeOf(time.Time{}), errs[0].Type)
+	assert.Equal(t, "timeout", errs[1].Key)
+
+	// invalid options panic when the struct is mapped, whatever the form is.
+	type BadLoc struct {
+		At time.Time `form:"at,loc=Mars/Olympus"`
+	}
+	assert.Panics(t, func() { fm.FormToStruct(map[string][]string{}, &BadLoc{}) })
+	type Conflict struct {
+		At time.Time `form:"at,unix,layout=DateOnly"`
+	}
+	assert.Panics(t, func() { fm.FormToStruct(map[string][]string{}, &Conflict{}) })
+
+	// the options are ignored for the fields other than time.Time.
+	type Clock struct {
+		Hour  int       `form:"hour,unix,loc=Mars/Olympus"`
+		Start time.Time `form:"start"`
+	}
+	var c Clock
+	assert.Nil(t, fm.FormToStruct(map[string][]string{"hour": {"8"}, "start": {"2024-03-01T00:00:00Z"}}, &c))
+	assert.Equal(t, 8, c.Hour)
+	sm := fm.mapper.TypeMap(reflect.TypeOf(c))
+	assert.Nil(t, sm.Paths["hour"].convs)
+	assert.Nil(t, sm.Paths["start"].convs)
+}
+
+func TestTimeBinder(t *testing.T) {
+	b := NewBinder("", nil)
+	shanghai, err := time.LoadLocation("Asia/Shanghai")
+	assert.Nil(t, err)
+	day := time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC)
+	until := time.Date(2024, 3, 1, 0, 0, 0, 123e6, time.UTC)
+
+	// the time options are the same whatever the Content-Type is.
+	for ct, body := range map[string]string{
+		"application/x-www-form-urlencoded": "day=2024-03-02&local=2024-03-03+09:15&until=1709251200123&holidays=2024-05-01,2024-10-01&slots[noon]=12:00&timeout=1m30s",
+		"application/json":                  `{"day": "2024-03-02", "local": "2024-03-03 09:15", "until": 1709251200123, "holidays": "2024-05-01,2024-10-01", "slots": {"noon": "12:00"}, "timeout": "1m30s"}`,
+		"application/xml":                   `<s><day>2024-03-02</day><local>2024-03-03 09:15</local><until>1709251200123</until><holidays>2024-05-01</holidays><holidays>2024-10-01</holidays><slots><noon>12:00</noon></slots><timeout>1m30s</timeout></s>`,
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		r.Header.Set("Content-Type", ct)
+		var s Schedule
+		assert.Nil(t, b.Bind(r, &s), ct)
+		assert.Equal(t, day, *s.Day, ct)
+		assert.Equal(t, time.Date(2024, 3, 3, 9, 15, 0, 0, shanghai), s.Local, ct)
+		assert.Equal(t, until, s.Until, ct)
+		assert.Equal(t, []time.Time{time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 10, 1, 0, 0, 0, 0, time.UTC)}, s.Holidays, ct)
+		assert.Equal(t, time.Date(0, 1, 1, 12, 0, 0, 0, time.UTC), s.Slots["noon"], ct)
+		assert.Equal(t, 90*time.Second, s.Timeout, ct)
+	}
+
+	// the strings are parsed by the layout of the field.
+	for ct, body := range map[string]string{
+		"application/json": `{"day": "03/02/2024"}`,
+		"application/xml":  `<s><day>03/02/2024</day></s>`,
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		r.Header.Set("Content-Type", ct)
+		err := b.Bind(r, &Schedule{})
+		errs, ok := err.(BindErrors)
+		assert.True(t, ok, ct)
+		assert.Equal(t, "day", errs[0].Key, ct)
+		assert.Contains(t, err.Error(), `as "2006-01-02"`, ct)
+	}
+}
+
+func TestTimeDefault(t *testing.T) {
+	type Options struct {
+		Timeout  time.Duration            `default:"5s"`
+		Interval *time.Duration           `default:"250ms"`
+		Backoff  []time.Duration          `default:"1s,2s,4s"`
+		Limits   map[string]time.Duration `default:"read=3s,write=10s"`
+		Since    time.Time                `default:"2024-01-01T00:00:00Z"`
+		Until    *time.Time               `default:"2024-12-31,layout=DateOnly"`
+	}
+	var o Options
+	SetDefault(&o)
+	assert.Equal(t, 5*time.Second, o.Timeout)
+	assert.Equal(t, 250*time.Millisecond, *o.Interval)
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second}, o.Backoff)
+	assert.Equal(t, map[string]time.Duration{"read": 3 * time.Second, "write": 10 * time.Second}, o.Limits)
+	assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), o.Since)
+	assert.Equal(t, time.Date(2024, 12, 31, 0, 0, 0, 0, time.UTC), *o.Until)
+
+	// the non-zero fields are kept.
+	since := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	o = Options{Timeout: time.Minute, Since: since}
+	SetDefault(&o)
+	assert.Equal(t, time.Minute, o.Timeout)
+	assert.Equal(t, since, o.Since)
+	assert.Equal(t, 250*time.Millisecond, *o.Interval)
+}
+
+func TestTimeValue(t *testing.T) {
+	var d time.Duration
+	dv := reflect.ValueOf(&d).Elem()
+	assert.Nil(t, StrToValue("1h2m", dv))
+	assert.Equal(t, time.Hour+2*time.Minute, d)
+	assert.Nil(t, StrToValue("1500", dv))
+	assert.Equal(t, time.Duration(1500), d)
+	assert.NotNil(t, StrToValue("soon", dv))
+	s, err := ValueToStr(dv)
+	assert.Nil(t, err)
+	assert.Equal(t, "1.5µs", s)
+
+	var tm time.Time
+	tv := reflect.ValueOf(&tm).Elem()
+	assert.Nil(t, StrToValue("2024-03-01T08:30:00+08:00", tv))
+	s, err = ValueToStr(tv)
+	assert.Nil(t, err)
+	assert.Equal(t, "2024-03-01T08:30:00+08:00", s)
+	assert.NotNil(t, StrToValue("2024-03-01", tv))
+
+	var ptm *time.Time
+	s, err = ValueToStr(reflect.ValueOf(ptm))
+	assert.Nil(t, err)
+	assert.Equal(t, "", s)
+
+	// SetValue converts strings and numbers.
+	assert.Nil(t, SetValue(dv, reflect.ValueOf("3s")))
+	assert.Equal(t, 3*time.Second, d)
+	assert.Nil(t, SetValue(dv, reflect.ValueOf(int64(42))))
+	assert.Equal(t, time.Duration(42), d)
+	assert.Nil(t, SetValue(dv, reflect.ValueOf(float64(2e9))))
+	assert.Equal(t, 2*time.Second, d)
+
+	assert.Nil(t, SetValue(tv, reflect.ValueOf("2024-03-01T00:00:00Z")))
+	assert.Equal(t, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), tm)
+	assert.Nil(t, SetValue(tv, reflect.ValueOf(1709251200)))
+	assert.Equal(t, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), tm)
+	assert.Nil(t, SetValue(tv, reflect.ValueOf(1709251200.25)))
+	assert.Equal(t, time.Date(2024, 3, 1, 0, 0, 0, 25e7, time.UTC), tm)
+	assert.NotNil(t, SetValue(tv, reflect.ValueOf(true)))
+
+	// Reflector encodes them by the marshalers rather than the built-in converters.
+	data, err := NewReflector("json", "", nil).Encode(map[string]interface{}{"d": time.Second, "t": time.Unix(0, 0).UTC()})
+	assert.Nil(t, err)
+	assert.Equal(t, `{"d":1000000000,"t":"1970-01-01T00:00:00Z"}`, string(data))
+
+	var ms map[string]time.Time
+	assert.Nil(t, SetValue(reflect.ValueOf(&ms).Elem(), reflect.ValueOf(map[string]interface{}{"at": 0})))
+	assert.Equal(t, time.Unix(0, 0).UTC(), ms["at"])
+}
@@ -1,6 +1,7 @@
 package reflectx
 
 import (
+	"encoding"
 	"errors"
 	"fmt"
 	"reflect"
@@ -71,11 +72,18 @@ func methodName() string {
 
 // Convert the value of field to string
 func ValueToStr(field reflect.Value) (string, error) {
+	return valueToStr(field, nil)
+}
+
+func valueToStr(field reflect.Value, cs *converters) (string, error) {
 	if field.Kind() == reflect.Ptr && field.IsNil() {
 		return "", nil
 	}
 
 	v := reflect.Indirect(field)
+	if c, ok := cs.lookup(v.Type()); ok {
+		return c.encode(v)
+	}
 	switch v.Kind() {
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
 		return strconv.FormatInt(v.Int(), 10), nil
@@ -96,6 +104,10 @@ func ValueToStr(field reflect.Value) (string, error) {
 
 // Set value of field by string, field must can be set.
 func StrToValue(str string, field reflect.Value) (err error) {
+	return strToValue(str, field, nil)
+}
+
+func strToValue(str string, field reflect.Value, cs *converters) (err error) {
 	// empty string means nil point
 	if field.Kind() == reflect.Ptr && str == "" {
 		field.Set(reflect.Zero(field.Type()))
@@ -103,6 +115,9 @@ func StrToValue(str string, field reflect.Value) (err error) {
 	}
 
 	v := AllocIndirect(field)
+	if c, ok := cs.lookup(v.Type()); ok {
+		return c.decode(str, v)
+	}
 	switch v.Kind() {
 	case reflect.Int:
 		err = setIntField(str, 0, v)
@@ -219,7 +234,15 @@ func IsStruct(v interface{}) bool {
 // float, int, uint... ->base type
 // []interface{}, []int, []float... -> []int
 // map[int]float... ---> map[float]float
+// string -> encoding.TextUnmarshaler
+// string, int, float -> time.Duration, the numbers are nanoseconds
+// int, float -> time.Time, the numbers are seconds since the Unix epoch
+// The types with a registered converter are converted by string.
 func SetValue(field, v reflect.Value) error {
+	return setValue(field, v, nil)
+}
+
+func setValue(field, v reflect.Value, cs *converters) error {
 	v = reflect.Indirect(v)
 	// get real type of  the interface{} points to.
 	if v.Kind() == reflect.Interface {
@@ -237,6 +260,23 @@ func SetValue(field, v reflect.Value) error {
 		return nil
 	}
 
+	if c, ok := cs.lookup(fT); ok {
+		if v.Kind() == reflect.String {
+			return c.decode(v.String(), field)
+		}
+		if c.builtin && fT == timeType {
+			return setTime(field, v)
+		}
+		str, err := valueToStr(v, cs)
+		if err != nil {
+			return err
+		}
+		return c.decode(str, field)
+	}
+	if v.Kind() == reflect.String && implementsOf(fT)&implTextUnmarshaler != 0 {
+		return field.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(v.String()))
+	}
+
 	switch fT.Kind() {
 	case reflect.Struct:
 		if fT != v.Type() {
@@ -254,7 +294,7 @@ func SetValue(field, v reflect.Value) error {
 		numElems := v.Len()
 		s := reflect.MakeSlice(field.Type(), numElems, numElems)
 		for i := 0; i < numElems; i++ {
-			if err := SetValue(s.Index(i), v.Index(i)); err != nil {
+			if err := setValue(s.Index(i), v.Index(i), cs); err != nil {
 				return err
 			}
 		}
@@ -279,21 +319,21 @@ func SetValue(field, v reflect.Value) error {
 			key := reflect.New(keyT).Elem()
 			elem := reflect.New(elemT).Elem()
 			// set key and elem
-			if err := SetValue(key, vk); err != nil {
+			if err := setValue(key, vk, cs); err != nil {
 				return err
 			}
-			if err := SetValue(elem, ve); err != nil {
+			if err := setValue(elem, ve, cs); err != nil {
 				return err
 			}
 			mp.SetMapIndex(key, elem)
 		}
 		field.Set(mp)
 	default:
-		str, err := ValueToStr(v)
+		str, err := valueToStr(v, cs)
 		if err != nil {
 			return err
 		}
-		return StrToValue(str, field)
+		return strToValue(str, field, cs)
 	}
 
 	return nil
@@ -323,28 +363,40 @@ func floatToInt(f float64) (n int64, err error) {
 // paresInt returns a int from string, including float values like "10.000".
 func parseInt(s string, bitSize int) (int64, error) {
 	i, err := strconv.ParseInt(s, 0, bitSize)
-	if err != nil {
+	if err != nil && errors.Is(err, strconv.ErrSyntax) {
 		// try again if s is a float value like "10.000"
-		if f, err := strconv.ParseFloat(s, 64); err == nil {
-			return floatToInt(f)
+		if f, ferr := strconv.ParseFloat(s, 64); ferr == nil {
+			if i, err = floatToInt(f); err == nil {
+				// check the range of bitSize
+				return strconv.ParseInt(strconv.FormatInt(i, 10), 10, bitSize)
+			}
 		}
 	}
 	return i, err
 }
 
-// paresInt returns a int from string, including float values like "10.000".
+// paresUint returns a uint from string, including float values like "10.000".
 func parseUint(s string, bitSize int) (uint64, error) {
-	//n, err = strconv.ParseUint(s, 0, bitSize)
-	//connot convert "-1", for example:
+	// ParseUint first, ParseInt can not parse the number greater than math.MaxInt64.
+	n, err := strconv.ParseUint(s, 0, bitSize)
+	if err == nil {
+		return n, nil
+	}
+	//strconv.ParseUint connot convert "-1", for example:
 	// vs.Set("-1", -1)
 	// fmt.Print(vs.ValueOf("-1").Uint()
 	// if vs is form, it returns an error.
-	n, err := strconv.ParseInt(s, 0, bitSize)
-	if err != nil {
+	if i, ierr := strconv.ParseInt(s, 0, bitSize); ierr == nil {
+		return uint64(i), nil
+	}
+	if errors.Is(err, strconv.ErrSyntax) {
 		// try again if s is a float value like "10.000"
-		if f, err := strconv.ParseFloat(s, 64); err == nil {
-			return floatToUint(f)
+		if f, ferr := strconv.ParseFloat(s, 64); ferr == nil {
+			if n, err = floatToUint(f); err == nil {
+				// check the range of bitSize
+				return strconv.ParseUint(strconv.FormatUint(n, 10), 10, bitSize)
+			}
 		}
 	}
-	return uint64(n), err
+	return 0, err
 }
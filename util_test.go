@@ -79,6 +79,13 @@ func TestSetValue(t *testing.T) {
 		So(equal(a.Interface(), mp, t), ShouldBeTrue)
 	})
 
+	Convey("should set encoding.TextUnmarshaler by string", t, func() {
+		a := reflect.New(reflect.TypeOf(map[Level]int{})).Elem()
+		err := SetValue(a, reflect.ValueOf(map[string]int{"***": 1}))
+		So(err, ShouldBeNil)
+		So(a.Interface(), ShouldResemble, map[Level]int{3: 1})
+	})
+
 	Convey("should set slice correctly", t, func() {
 		a := reflect.New(reflect.TypeOf([]interface{}{})).Elem()
 		s := []interface{}{1, 2.0, true, false, new(int), new(float64)}
@@ -0,0 +1,610 @@
+package reflectx
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+var defaultValidator = NewValidator("", nil)
+
+// RuleFunc checks the field v by the param of the rule, such as "1" of
+// "min=1". v is not a pointer, it returns the reason if v is invalid.
+type RuleFunc func(v reflect.Value, param string) error
+
+// ValidationError describes a field which breaks a rule.
+type ValidationError struct {
+	Path  string      // the mapped path of the field, such as "items.0.qty".
+	Rule  string      // the name of the rule, such as "min".
+	Param string      // the param of the rule, such as "1".
+	Value interface{} // the value of the field, nil if the pointer is nil.
+	Err   error       // the reason.
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("reflectx: %s %s", e.Path, strings.TrimPrefix(e.Err.Error(), "reflectx: "))
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationErrors is returned by Validate with all the broken rules, in
+// order of the fields.
+type ValidationErrors []*ValidationError
+
+func (es ValidationErrors) Error() string {
+	msgs := make([]string, len(es))
+	for i, e := range es {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// rule is a rule parsed from the tag, dive is a rule as well.
+type rule struct {
+	name  string
+	param string
+}
+
+// the rules compare the field with another field of the same struct.
+var crossFieldRules = map[string]bool{
+	"eqfield": true, "nefield": true,
+	"gtfield": true, "gtefield": true,
+	"ltfield": true, "ltefield": true,
+}
+
+// Validator validates the fields of structs by the rules of tags, for example:
+//	type Signup struct {
+//		Name     string   `form:"name" validate:"required,min=1,max=64,regexp=^[a-z]+$"`
+//		Email    string   `form:"email" validate:"required,email"`
+//		Password string   `form:"password" validate:"min=8"`
+//		Confirm  string   `form:"confirm" validate:"eqfield=Password"`
+//		Plan     string   `form:"plan" validate:"oneof=free|pro"`
+//		Tags     []string `form:"tags" validate:"max=5,dive,len=3"`
+//	}
+// The rules before "dive" are applied to the slice, array or map itself,
+// the rules after it are applied to every element. Nested structs are
+// always validated, the structs in slices, arrays or maps are validated
+// with "dive". A ',' in the param of a rule is escaped as "\,".
+// The rules are skipped for nil pointers except "required", and for zero
+// values after "omitempty".
+// Only the first broken rule of a field is reported.
+// Cross-field rules such as "eqfield" and "gtfield" take the path of Go field
+// names relative to the struct of the field, such as "Password" or "Range.Min".
+type Validator struct {
+	tagName string
+	mapper  *Mapper   // maps the paths in errors.
+	rules   *sync.Map // map[string]RuleFunc
+	cache   *sync.Map // map[tagKey][]rule, and map[reflect.Type]bool of the checked structs
+}
+
+// the tag of a field in the struct type.
+type tagKey struct {
+	t     reflect.Type
+	index int
+}
+
+// NewValidator returns a Validator reading the rules from tagName, and
+// naming the fields in errors by mapper. Default tagName is "validate",
+// default mapper is StdMapper.
+// FormMapper and Reflector name the fields by their own mappers.
+func NewValidator(tagName string, mapper *Mapper) *Validator {
+	if tagName == "" {
+		tagName = "validate"
+	}
+	if mapper == nil {
+		mapper = StdMapper
+	}
+	v := &Validator{
+		tagName: tagName,
+		mapper:  mapper,
+		rules:   &sync.Map{},
+		cache:   &sync.Map{},
+	}
+	for name, fn := range builtinRules {
+		v.rules.Store(name, fn)
+	}
+	return v
+}
+
+// ValidateForms validates the structs by vd after FormToStruct, Bind and
+// Binder.Bind, the fields are named by the FormMapper in errors. The binding
+// errors are returned without validation.
+func ValidateForms(vd *Validator) FormOption {
+	return func(fm *FormMapper) {
+		fm.validator = vd
+	}
+}
+
+// ValidateDecoded validates the structs by vd after Decode and DecodeInto,
+// the fields are named by the Reflector in errors. The decoding errors are
+// returned without validation.
+func ValidateDecoded(vd *Validator) ReflectorOption {
+	return func(r *reflector) {
+		r.validator = vd
+	}
+}
+
+// RegisterRule registers the rule of name to the default Validator.
+func RegisterRule(name string, fn RuleFunc) {
+	defaultValidator.RegisterRule(name, fn)
+}
+
+// Validate validates the struct that ptr points to by the default Validator.
+func Validate(ptr interface{}) error {
+	return defaultValidator.Validate(ptr)
+}
+
+// RegisterRule registers the rule of name, it replaces the existing one.
+// Rules should be registered before validating the types using them.
+func (vd *Validator) RegisterRule(name string, fn RuleFunc) {
+	if fn == nil || name == "dive" || name == "required" || name == "omitempty" || crossFieldRules[name] {
+		panic("reflectx: can not register rule " + name)
+	}
+	vd.rules.Store(name, fn)
+}
+
+// Validate validates the struct or the struct that ptr points to, it
+// returns ValidationErrors with all the broken rules.
+func (vd *Validator) Validate(ptr interface{}) error {
+	return vd.validate(reflect.ValueOf(ptr), vd.mapper)
+}
+
+// validate validates the struct v and names the fields by m.
+func (vd *Validator) validate(v reflect.Value, m *Mapper) error {
+	v = reflect.Indirect(v)
+	if v.Kind() != reflect.Struct {
+		return fmt.Errorf("reflectx: Validate expects a struct, got %v", v.Kind())
+	}
+	vd.checkType(v.Type(), m)
+	var errs ValidationErrors
+	vd.validateStruct("", v, m, &errs)
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+func (vd *Validator) validateStruct(prefix string, v reflect.Value, m *Mapper, errs *ValidationErrors) {
+	sm := m.TypeMap(v.Type())
+	for _, fi := range sm.Fields {
+		fV := FieldByIndexesReadOnly(v, fi.Index)
+		if !fV.IsValid() {
+			// the parent is a nil pointer.
+			continue
+		}
+		rules := vd.fieldRules(v.Type(), fi.Index)
+		if len(rules) == 0 && m.convs.isLeaf(fi.Type) {
+			continue
+		}
+
+		path := joinPath(prefix, fi.Path)
+		rest := vd.applyRules(path, fV, rules, &fieldCtx{v, sm, fi}, errs)
+		// the fields of nested structs are in sm.Fields.
+		if rest != nil {
+			vd.dive(path, reflect.Indirect(fV), rest[1:], m, errs)
+		}
+	}
+}
+
+// fieldCtx is the struct field being validated, it is nil for the elements
+// of slices, arrays and maps.
+type fieldCtx struct {
+	root reflect.Value
+	sm   StructMap
+	fi   *FieldInfo
+}
+
+// applyRules applies the rules before "dive" to v, and returns the rules
+// from "dive", or nil if there is no "dive", v is skipped or invalid.
+func (vd *Validator) applyRules(path string, v reflect.Value, rules []rule, ctx *fieldCtx, errs *ValidationErrors) []rule {
+	isNil := (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && v.IsNil()
+	for i, r := range rules {
+		var err error
+		switch {
+		case r.name == "dive":
+			if isNil {
+				return nil
+			}
+			return rules[i:]
+		case r.name == "required":
+			if isNil || (v.Kind() != reflect.Ptr && isZeroValue(v)) {
+				err = errors.New("is required")
+			}
+		case isNil:
+			continue
+		case r.name == "omitempty":
+			if isZeroValue(v) {
+				return nil
+			}
+			continue
+		case crossFieldRules[r.name]:
+			err = crossField(r, v, ctx)
+		default:
+			// the rules are checked by checkRules.
+			fn, _ := vd.rules.Load(r.name)
+			err = fn.(RuleFunc)(deref(v), r.param)
+		}
+
+		if err != nil {
+			var value interface{}
+			if !isNil {
+				value = deref(v).Interface()
+			}
+			*errs = append(*errs, &ValidationError{Path: path, Rule: r.name, Param: r.param, Value: value, Err: err})
+			return nil
+		}
+	}
+	return nil
+}
+
+// dive applies the rules to the elements of v, the structs are validated as well.
+func (vd *Validator) dive(path string, v reflect.Value, rules []rule, m *Mapper, errs *ValidationErrors) {
+	each := func(key string, elem reflect.Value) {
+		elemPath := joinPath(path, key)
+		rest := vd.applyRules(elemPath, elem, rules, nil, errs)
+		elem = reflect.Indirect(elem)
+		if elem.Kind() == reflect.Interface {
+			elem = reflect.Indirect(elem.Elem())
+		}
+		if !elem.IsValid() {
+			return
+		}
+		if rest != nil {
+			vd.dive(elemPath, elem, rest[1:], m, errs)
+		} else if !m.convs.isLeaf(elem.Type()) {
+			vd.validateStruct(elemPath, elem, m, errs)
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			each(strconv.Itoa(i), v.Index(i))
+		}
+	case reflect.Map:
+		for _, k := range v.MapKeys() {
+			key, err := ValueToStr(k)
+			if err != nil {
+				key = fmt.Sprint(k.Interface())
+			}
+			each(key, v.MapIndex(k))
+		}
+	default:
+		// the dynamic value of interface{}, the static types are checked by checkRules.
+		*errs = append(*errs, &ValidationError{Path: path, Rule: "dive", Value: v.Interface(), Err: fmt.Errorf("can not dive into %v", v.Type())})
+	}
+}
+
+// fieldRules returns the rules of the field specified by index, t is the
+// struct type of the root.
+func (vd *Validator) fieldRules(t reflect.Type, index []int) []rule {
+	// the field is found by walking down the types of index.
+	for _, i := range index[:len(index)-1] {
+		t = Deref(t.Field(i).Type)
+	}
+	key := tagKey{t, index[len(index)-1]}
+	if rules, ok := vd.cache.Load(key); ok {
+		return rules.([]rule)
+	}
+	f := t.Field(key.index)
+	rules := parseRules(f.Tag.Get(vd.tagName))
+	vd.checkRules(t, f, rules)
+	vd.cache.Store(key, rules)
+	return rules
+}
+
+// checkType parses and checks the rules of all the fields of the struct t
+// and the structs in the slices, arrays and maps of it, so that the invalid
+// rules panic before validating any value.
+func (vd *Validator) checkType(t reflect.Type, m *Mapper) {
+	if _, checked := vd.cache.LoadOrStore(t, true); checked {
+		return
+	}
+	for _, fi := range m.TypeMap(t).Fields {
+		vd.fieldRules(t, fi.Index)
+		elemT := Deref(fi.Type)
+		for elemT.Kind() == reflect.Slice || elemT.Kind() == reflect.Array || elemT.Kind() == reflect.Map {
+			elemT = Deref(elemT.Elem())
+		}
+		if elemT != Deref(fi.Type) && !m.convs.isLeaf(elemT) {
+			vd.checkType(elemT, m)
+		}
+	}
+}
+
+// checkRules panics if a rule of the field f of the struct t is unknown, or
+// "dive" is not applied to a slice, array or map. It is called when the rules
+// are parsed, before validating any value.
+func (vd *Validator) checkRules(t reflect.Type, f reflect.StructField, rules []rule) {
+	// fT is nil after diving into interface{}, which is checked by dive.
+	fT := f.Type
+	for _, r := range rules {
+		switch {
+		case r.name == "dive":
+			if fT == nil {
+				continue
+			}
+			switch fT = Deref(fT); fT.Kind() {
+			case reflect.Slice, reflect.Array, reflect.Map:
+				fT = fT.Elem()
+			case reflect.Interface:
+				fT = nil
+			default:
+				panic(fmt.Sprintf("reflectx: can not dive into %v of %v.%s", fT, t, f.Name))
+			}
+		case r.name == "required", r.name == "omitempty", crossFieldRules[r.name]:
+		default:
+			if _, ok := vd.rules.Load(r.name); !ok {
+				panic(fmt.Sprintf("reflectx: unknown validation rule %s of %v.%s", r.name, t, f.Name))
+			}
+		}
+	}
+}
+
+// parseRules splits the tag by ',', "\," is not a separator.
+func parseRules(tag string) []rule {
+	if tag == "" || tag == IgnoreThisField {
+		return nil
+	}
+	var rules []rule
+	var part strings.Builder
+	add := func() {
+		s := part.String()
+		part.Reset()
+		if s == "" {
+			return
+		}
+		r := rule{name: s}
+		if i := strings.IndexByte(s, '='); i >= 0 {
+			r.name, r.param = s[:i], s[i+1:]
+		}
+		rules = append(rules, r)
+	}
+	for i := 0; i < len(tag); i++ {
+		switch {
+		case tag[i] == '\\' && i+1 < len(tag) && tag[i+1] == ',':
+			part.WriteByte(',')
+			i++
+		case tag[i] == ',':
+			add()
+		default:
+			part.WriteByte(tag[i])
+		}
+	}
+	add()
+	return rules
+}
+
+// joinPath joins the paths by '.'.
+func joinPath(prefix, path string) string {
+	if prefix == "" {
+		return path
+	}
+	return prefix + "." + path
+}
+
+// deref returns the value that the pointers or interfaces of v point to.
+func deref(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return v
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+// crossField compares v with the field specified by the param of r, which is
+// relative to the struct of the field in ctx.
+func crossField(r rule, v reflect.Value, ctx *fieldCtx) error {
+	if ctx == nil {
+		return fmt.Errorf("reflectx: %s is only for struct fields", r.name)
+	}
+	parentIndex := ctx.fi.Index[:len(ctx.fi.Index)-1]
+	parent := reflect.Indirect(FieldByIndexesReadOnly(ctx.root, parentIndex))
+	ofi, ok := StdMapper.TypeMap(parent.Type()).Paths[r.param]
+	if !ok {
+		return fmt.Errorf("reflectx: unknown field %q to compare", r.param)
+	}
+	// the other field is named by the mapper in messages.
+	name := r.param
+	index := append(append([]int(nil), parentIndex...), ofi.Index...)
+	if mfi := ctx.sm.GetByTraversal(index); mfi != nil {
+		name = mfi.Path
+	}
+
+	other := deref(FieldByIndexesReadOnly(parent, ofi.Index))
+	v = deref(v)
+	if !other.IsValid() || other.Kind() == reflect.Ptr {
+		// the other field is nil.
+		return nil
+	}
+
+	if r.name == "eqfield" || r.name == "nefield" {
+		eq := reflect.DeepEqual(v.Interface(), other.Interface())
+		if r.name == "eqfield" && !eq {
+			return errors.New("must be equal to " + name)
+		}
+		if r.name == "nefield" && eq {
+			return errors.New("must not be equal to " + name)
+		}
+		return nil
+	}
+
+	c, ok := compare(v, other)
+	if !ok {
+		return fmt.Errorf("reflectx: can not compare %v with %v", v.Type(), other.Type())
+	}
+	switch {
+	case r.name == "gtfield" && c <= 0:
+		return errors.New("must be greater than " + name)
+	case r.name == "gtefield" && c < 0:
+		return errors.New("must be greater than or equal to " + name)
+	case r.name == "ltfield" && c >= 0:
+		return errors.New("must be less than " + name)
+	case r.name == "ltefield" && c > 0:
+		return errors.New("must be less than or equal to " + name)
+	}
+	return nil
+}
+
+// compare returns -1, 0 or 1 if a is less than, equal to or greater than b.
+// The numbers of the same kind, strings and time.Time are comparable.
+func compare(a, b reflect.Value) (int, bool) {
+	sign := func(less, greater bool) int {
+		switch {
+		case less:
+			return -1
+		case greater:
+			return 1
+		}
+		return 0
+	}
+
+	if a.Type() == timeType && b.Type() == timeType {
+		ta, tb := a.Interface().(time.Time), b.Interface().(time.Time)
+		return sign(ta.Before(tb), ta.After(tb)), true
+	}
+	switch {
+	case isInt(a.Kind()) && isInt(b.Kind()):
+		return sign(a.Int() < b.Int(), a.Int() > b.Int()), true
+	case isUint(a.Kind()) && isUint(b.Kind()):
+		return sign(a.Uint() < b.Uint(), a.Uint() > b.Uint()), true
+	case isFloat(a.Kind()) && isFloat(b.Kind()):
+		return sign(a.Float() < b.Float(), a.Float() > b.Float()), true
+	case a.Kind() == reflect.String && b.Kind() == reflect.String:
+		return strings.Compare(a.String(), b.String()), true
+	}
+	return 0, false
+}
+
+func isInt(k reflect.Kind) bool {
+	return k >= reflect.Int && k <= reflect.Int64
+}
+
+func isUint(k reflect.Kind) bool {
+	return k >= reflect.Uint && k <= reflect.Uintptr
+}
+
+func isFloat(k reflect.Kind) bool {
+	return k == reflect.Float32 || k == reflect.Float64
+}
+
+var builtinRules = map[string]RuleFunc{
+	"min": func(v reflect.Value, param string) error {
+		return checkSize(v, param, "at least", func(c int) bool { return c >= 0 })
+	},
+	"max": func(v reflect.Value, param string) error {
+		return checkSize(v, param, "at most", func(c int) bool { return c <= 0 })
+	},
+	"len": func(v reflect.Value, param string) error {
+		return checkSize(v, param, "", func(c int) bool { return c == 0 })
+	},
+	"oneof": func(v reflect.Value, param string) error {
+		s, err := ValueToStr(v)
+		if err != nil {
+			return err
+		}
+		for _, opt := range strings.Split(param, "|") {
+			if s == opt {
+				return nil
+			}
+		}
+		return errors.New("must be one of " + param)
+	},
+	"regexp": func(v reflect.Value, param string) error {
+		if v.Kind() != reflect.String {
+			return fmt.Errorf("reflectx: regexp expects a string, got %v", v.Type())
+		}
+		re, err := compileRegexp(param)
+		if err != nil {
+			return err
+		}
+		if !re.MatchString(v.String()) {
+			return errors.New("must match " + param)
+		}
+		return nil
+	},
+	"email": func(v reflect.Value, param string) error {
+		if v.Kind() != reflect.String {
+			return fmt.Errorf("reflectx: email expects a string, got %v", v.Type())
+		}
+		if addr, err := mail.ParseAddress(v.String()); err != nil || addr.Address != v.String() {
+			return errors.New("must be a valid email address")
+		}
+		return nil
+	},
+}
+
+var regexps sync.Map // map[string]*regexp.Regexp
+
+// compileRegexp returns the compiled regexp of expr, which is cached.
+func compileRegexp(expr string) (*regexp.Regexp, error) {
+	if re, ok := regexps.Load(expr); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	regexps.Store(expr, re)
+	return re, nil
+}
+
+// checkSize compares the size of v with the param, that is the value of
+// numbers, or the length of strings, slices, arrays and maps. ok checks the
+// result of the comparison.
+func checkSize(v reflect.Value, param, op string, ok func(c int) bool) error {
+	what := "must be "
+	var c int
+	switch k := v.Kind(); {
+	case isInt(k):
+		n, err := strconv.ParseInt(param, 10, 64)
+		if err != nil {
+			return err
+		}
+		c, _ = compare(v, reflect.ValueOf(n))
+	case isUint(k):
+		n, err := strconv.ParseUint(param, 10, 64)
+		if err != nil {
+			return err
+		}
+		c, _ = compare(v, reflect.ValueOf(n))
+	case isFloat(k):
+		n, err := strconv.ParseFloat(param, 64)
+		if err != nil {
+			return err
+		}
+		c, _ = compare(v, reflect.ValueOf(n))
+	case k == reflect.String, k == reflect.Slice, k == reflect.Array, k == reflect.Map:
+		n, err := strconv.Atoi(param)
+		if err != nil {
+			return err
+		}
+		size := v.Len()
+		if k == reflect.String {
+			size = utf8.RuneCountInString(v.String())
+		}
+		what = "length must be "
+		c, _ = compare(reflect.ValueOf(size), reflect.ValueOf(n))
+	default:
+		return fmt.Errorf("reflectx: can not check the size of %v", v.Type())
+	}
+
+	if ok(c) {
+		return nil
+	}
+	if op == "" {
+		return errors.New(what + param)
+	}
+	return errors.New(what + op + " " + param)
+}
@@ -0,0 +1,216 @@
+package reflectx
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type Account struct {
+	Name     string            `form:"name" validate:"required,min=2,max=8,regexp=^[a-z]+$"`
+	Email    string            `form:"email" validate:"required,email"`
+	Password string            `form:"password" validate:"len=8"`
+	Confirm  string            `form:"confirm" validate:"eqfield=Password"`
+	Plan     string            `form:"plan" validate:"omitempty,oneof=free|pro"`
+	Age      *int              `form:"age" validate:"min=18"`
+	Tags     []string          `form:"tags" validate:"max=3,dive,min=1"`
+	Items    []LineItem        `form:"items" validate:"dive"`
+	Limits   map[string]int    `form:"limits" validate:"dive,max=10"`
+	Period   Period            `form:"period"`
+	Badge    *Badge            `form:"profile" validate:"required"`
+	Extra    map[string]string `form:"extra"`
+}
+
+type Period struct {
+	Start time.Time `form:"start"`
+	End   time.Time `form:"end" validate:"omitempty,gtfield=Start"`
+}
+
+type Badge struct {
+	Code string `form:"code" validate:"len=3,regexp=^[A-Z]{2\\,3}$"`
+}
+
+func validAccount() Account {
+	now := time.Now()
+	return Account{
+		Name:     "alice",
+		Email:    "alice@example.com",
+		Password: "12345678",
+		Confirm:  "12345678",
+		Tags:     []string{"a", "b"},
+		Items:    []LineItem{{Name: "x", Qty: 1}},
+		Limits:   map[string]int{"cpu": 4},
+		Period:   Period{Start: now, End: now.Add(time.Hour)},
+		Badge:    &Badge{Code: "ABC"},
+	}
+}
+
+func TestValidate(t *testing.T) {
+	a := validAccount()
+	vd := NewValidator("", NewMapper("form", nil))
+	assert.Nil(t, vd.Validate(&a))
+	assert.Nil(t, vd.Validate(a))
+
+	age := 16
+	a.Name = "Alice!"
+	a.Email = "alice"
+	a.Confirm = "1234"
+	a.Plan = "gold"
+	a.Age = &age
+	a.Tags = []string{"a", "", "c"}
+	a.Limits["mem"] = 16
+	a.Period.End = a.Period.Start
+	a.Badge.Code = "abc"
+	err := vd.Validate(&a)
+	errs, ok := err.(ValidationErrors)
+	assert.True(t, ok)
+
+	var got []string
+	for _, e := range errs {
+		got = append(got, e.Path+" "+e.Rule)
+	}
+	assert.Equal(t, []string{
+		"name regexp",
+		"email email",
+		"confirm eqfield",
+		"plan oneof",
+		"age min",
+		"tags.1 min",
+		"limits.mem max",
+		"period.end gtfield",
+		"profile.code regexp",
+	}, got)
+	assert.Equal(t, "reflectx: confirm must be equal to password", errs[2].Error())
+	assert.Equal(t, "reflectx: age must be at least 18", errs[4].Error())
+	assert.Equal(t, 16, errs[4].Value)
+	assert.Equal(t, "reflectx: tags.1 length must be at least 1", errs[5].Error())
+	assert.Equal(t, "reflectx: limits.mem must be at most 10", errs[6].Error())
+	assert.Equal(t, "reflectx: period.end must be greater than period.start", errs[7].Error())
+
+	// only the first broken rule of a field is reported.
+	a = validAccount()
+	a.Tags = []string{"a", "b", "c", ""}
+	assert.EqualError(t, vd.Validate(&a), "reflectx: tags length must be at most 3")
+
+	// required and nested structs in slices.
+	a = validAccount()
+	a.Name = ""
+	a.Badge = nil
+	a.Items = []LineItem{{}, {Name: "x"}}
+	err = vd.Validate(&a)
+	assert.EqualError(t, err, "reflectx: name is required; reflectx: profile is required")
+
+	// the paths are named by the mapper.
+	a = validAccount()
+	a.Name = "x"
+	assert.EqualError(t, NewValidator("", nil).Validate(&a), "reflectx: Name length must be at least 2")
+}
+
+func TestValidateDive(t *testing.T) {
+	type Matrix struct {
+		Rows  [][]int            `validate:"len=2,dive,len=2,dive,min=0"`
+		Items []*LineItem        `validate:"required,dive,required"`
+		Named map[string]Account `validate:"dive"`
+	}
+	vd := NewValidator("", nil)
+	m := Matrix{
+		Rows:  [][]int{{1, 2}, {3, -4}},
+		Items: []*LineItem{{}, nil},
+		Named: map[string]Account{"a": {Name: "bob"}},
+	}
+	err := vd.Validate(&m)
+	errs := err.(ValidationErrors)
+	var got []string
+	for _, e := range errs {
+		got = append(got, e.Path+" "+e.Rule)
+	}
+	assert.Equal(t, []string{
+		"Rows.1.1 min",
+		"Items.1 required",
+		"Named.a.Email required",
+		"Named.a.Password len",
+		"Named.a.Badge required",
+	}, got)
+}
+
+func TestRegisterRule(t *testing.T) {
+	type Color struct {
+		Hex string `validate:"hex=6"`
+	}
+	vd := NewValidator("", nil)
+	vd.RegisterRule("hex", func(v reflect.Value, param string) error {
+		s := v.String()
+		if len(s) != 7 || s[0] != '#' {
+			return errors.New("must be a hex color")
+		}
+		return nil
+	})
+	assert.Nil(t, vd.Validate(&Color{"#ffffff"}))
+	assert.EqualError(t, vd.Validate(&Color{"red"}), "reflectx: Hex must be a hex color")
+
+	assert.Panics(t, func() { vd.RegisterRule("required", nil) })
+	assert.Panics(t, func() { NewValidator("", nil).Validate(&Color{"red"}) })
+
+	// invalid rules panic before validating any value.
+	type Palette struct {
+		Colors []Color
+	}
+	assert.Panics(t, func() { NewValidator("", nil).Validate(&Palette{}) })
+	type Misplaced struct {
+		Name *string `validate:"dive,min=1"`
+	}
+	assert.Panics(t, func() { NewValidator("", nil).Validate(&Misplaced{}) })
+
+	// the dynamic values of interface{} are reported.
+	type Any struct {
+		Items []interface{} `validate:"dive,dive,min=1"`
+	}
+	err := NewValidator("", nil).Validate(&Any{Items: []interface{}{[]int{1}, 2}})
+	assert.EqualError(t, err, "reflectx: Items.1 can not dive into int")
+}
+
+func TestValidatePostStep(t *testing.T) {
+	vd := NewValidator("", nil)
+
+	// FormToStruct validates after binding.
+	fm := NewFormMapper("", nil, ValidateForms(vd))
+	var a Account
+	err := fm.FormToStruct(map[string][]string{"name": {"x"}, "age": {"y"}}, &a)
+	_, ok := err.(BindErrors)
+	assert.True(t, ok)
+	err = fm.FormToStruct(map[string][]string{"name": {"x"}}, &a)
+	errs, ok := err.(ValidationErrors)
+	assert.True(t, ok)
+	assert.Equal(t, "name", errs[0].Path)
+
+	// Decode and DecodeInto validate after decoding, the paths are named by the Reflector.
+	r := NewReflector("json", "form", nil, ValidateDecoded(vd))
+	r.Register(Account{})
+	a = validAccount()
+	a.Name = "x"
+	b, err := r.Encode(a)
+	assert.Nil(t, err)
+	_, err = r.Decode(b)
+	assert.EqualError(t, err, "reflectx: name length must be at least 2")
+	err = r.DecodeInto(b, &Account{})
+	assert.EqualError(t, err, "reflectx: name length must be at least 2")
+
+	// Binder validates after binding both the query and the body.
+	binder := NewBinder("", nil, ValidateForms(vd))
+	body := `{"email": "bob@example.com", "password": "12345678", "confirm": "12345678", "profile": {"code": "ABC"}}`
+	req := httptest.NewRequest(http.MethodPost, "/signup?name=bob", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	a = Account{}
+	assert.Nil(t, binder.Bind(req, &a))
+	assert.Equal(t, "bob", a.Name)
+
+	req = httptest.NewRequest(http.MethodPost, "/signup", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	assert.EqualError(t, binder.Bind(req, &Account{}), "reflectx: name is required")
+}
@@ -1,6 +1,7 @@
 package reflectx
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"strconv"
@@ -89,6 +90,12 @@ func (v Value) Plus(step interface{}) Value {
 		} else {
 			result = step
 		}
+	case json.Number: //if m is decode by json with UseNumber
+		if orig, err := parseInt(string(val), 64); err == nil {
+			result = json.Number(strconv.FormatInt(orig+i, 10))
+		} else {
+			result = step
+		}
 	default:
 		result = step
 	}
@@ -108,7 +115,8 @@ func (v Value) String() string {
 // ToInt64 returns an int64 number from v.
 // It returns ErrNil if v is nil.
 // It returns an error if the type of value is not numeric.
-// Note that, if v is decode by json, evey number has float64 type.
+// Note that, if v is decode by json, evey number has float64 type,
+// or json.Number type if json.Decoder.UseNumber is called.
 // If v is decode by bson, number only has int, int64 type.
 func (v Value) ToInt64() (int64, error) {
 	switch val := v.v.(type) {
@@ -140,6 +148,8 @@ func (v Value) ToInt64() (int64, error) {
 		return floatToInt(val)
 	case string:
 		return parseInt(val, 64)
+	case json.Number:
+		return parseInt(string(val), 64)
 	default:
 		return 0, fmt.Errorf("can't get int from %v", val)
 	}
@@ -163,7 +173,8 @@ func (v Value) MustInt64() int64 {
 // ToInt returns an int number from v.
 // It returns ErrNil if v is nil.
 // It returns an error if the type of value is not numeric.
-// Note that, if v is decode by json, evey number has float64 type.
+// Note that, if v is decode by json, evey number has float64 type,
+// or json.Number type if json.Decoder.UseNumber is called.
 // If v is decode by bson, number only has int, int64 type.
 func (v Value) ToInt() (int, error) {
 	i, err := v.ToInt64()
@@ -187,7 +198,8 @@ func (v Value) MustInt() int {
 
 // ToUint64 returns ErrNil if v is nil.
 // It returns an error if the  type of value is not numeric.
-// Note that, if v is decode by json, evey number has float64 type.
+// Note that, if v is decode by json, evey number has float64 type,
+// or json.Number type if json.Decoder.UseNumber is called.
 // If v is decode by bson, number only has int, int64 type.
 func (v Value) ToUint64() (uint64, error) {
 	switch val := v.v.(type) {
@@ -219,6 +231,8 @@ func (v Value) ToUint64() (uint64, error) {
 		return floatToUint(val)
 	case string:
 		return parseUint(val, 64)
+	case json.Number:
+		return parseUint(string(val), 64)
 	default:
 		return 0, fmt.Errorf("can't get uint from %v", val)
 	}
@@ -242,7 +256,8 @@ func (v Value) MustUint64() uint64 {
 // ToUint returns an int number from v.
 // It returns ErrNil if v is nil.
 // It returns an error if the type of value is not numeric.
-// Note that, if v is decode by json, evey number has float64 type.
+// Note that, if v is decode by json, evey number has float64 type,
+// or json.Number type if json.Decoder.UseNumber is called.
 // If v is decode by bson, number only has int, int64 type.
 func (v Value) ToUint() (uint, error) {
 	n, err := v.ToUint64()
@@ -298,6 +313,8 @@ func (v Value) ToFloat() (float64, error) {
 		return val, nil
 	case string:
 		return strconv.ParseFloat(val, 64)
+	case json.Number:
+		return val.Float64()
 	default:
 		return 0, fmt.Errorf("can't get float from %v", val)
 	}
@@ -1,7 +1,10 @@
 package values
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"io"
 
 	"github.com/zltgo/reflectx"
 )
@@ -14,8 +17,18 @@ func (m JsonMap) Encode() ([]byte, error) {
 	return json.Marshal(m)
 }
 
+// Decode decodes numbers to json.Number, so int64 and uint64 do not lose
+// precision, use ValueOf to get the number with the expected type.
 func (m *JsonMap) Decode(b []byte) error {
-	return json.Unmarshal(b, m)
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	if err := d.Decode(m); err != nil {
+		return err
+	}
+	if _, err := d.Token(); err != io.EOF {
+		return errors.New("values: invalid data after top-level value")
+	}
+	return nil
 }
 
 // Get value from values, it returns nil in case of non-existed.
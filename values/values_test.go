@@ -1,6 +1,7 @@
 package values
 
 import (
+	"encoding/json"
 	"math"
 	"sync"
 	"testing"
@@ -24,7 +25,9 @@ func TestForm(t *testing.T) {
 		fm.Set("4", []interface{}{4, true, 3.14, "pi"})
 		So(fm, ShouldResemble, gf)
 
-		So(func() { fm.Set("5", time.Now()) }, ShouldPanic)
+		So(func() { fm.Set("5", struct{}{}) }, ShouldPanic)
+		fm.Set("5", time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))
+		So(fm["5"], ShouldResemble, []string{"2024-01-02T03:04:05Z"})
 	})
 
 	Convey("test form add string", t, func() {
@@ -108,7 +111,8 @@ func TestJsonMap(t *testing.T) {
 		err = fm.Decode(b)
 		So(err, ShouldBeNil)
 
-		So(fm["1"], ShouldEqual, 1)
+		So(fm["1"], ShouldEqual, json.Number("1"))
+		So(fm.ValueOf("1").MustInt(), ShouldEqual, 1)
 		So(fm["2"], ShouldEqual, "2")
 		So(fm["3"], ShouldResemble, []interface{}{"3", "2333"})
 		//So(fm["4"], ShouldResemble, []interface{}{4, true, 3.14, "pi"})
@@ -124,6 +128,38 @@ func TestJsonMap(t *testing.T) {
 	})
 }
 
+func TestJsonMapNumbers(t *testing.T) {
+	Convey("should keep the precision of int64 and uint64", t, func() {
+		gf := JsonMap{
+			"maxInt64":  int64(math.MaxInt64),
+			"minInt64":  int64(math.MinInt64),
+			"maxUint64": uint64(math.MaxUint64),
+			"float":     3.14,
+		}
+		b, err := gf.Encode()
+		So(err, ShouldBeNil)
+
+		fm := JsonMap{}
+		So(fm.Decode(b), ShouldBeNil)
+		So(fm.ValueOf("maxInt64").MustInt64(), ShouldEqual, int64(math.MaxInt64))
+		So(fm.ValueOf("minInt64").MustInt64(), ShouldEqual, int64(math.MinInt64))
+		So(fm.ValueOf("maxUint64").MustUint64(), ShouldEqual, uint64(math.MaxUint64))
+		So(fm.ValueOf("float").MustFloat(), ShouldEqual, 3.14)
+		So(fm.ValueOf("maxInt64").String(), ShouldEqual, "9223372036854775807")
+
+		So(AddInt64(&fm, "minInt64", 1), ShouldEqual, int64(math.MinInt64+1))
+		So(fm["minInt64"], ShouldEqual, json.Number("-9223372036854775807"))
+
+		_, err = fm.ValueOf("float").ToInt64()
+		So(err.Error(), ShouldEqual, "cann't convert 3.14 to int")
+	})
+
+	Convey("should return error for invalid data", t, func() {
+		fm := JsonMap{}
+		So(fm.Decode([]byte(`{"a": 1} }`)), ShouldNotBeNil)
+	})
+}
+
 func TestSafeMap(t *testing.T) {
 	sm := SafeMap{}
 	vs := &sm